@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"io"
+	"net/http"
 	"os"
-	"os/exec"
-	"strings"
+	"os/signal"
+	"syscall"
 
 	"github.com/cloudogu/sonarcarp/config"
+	"github.com/cloudogu/sonarcarp/payload"
 	"github.com/cloudogu/sonarcarp/proxy"
 	"github.com/op/go-logging"
 )
@@ -15,44 +17,56 @@ import (
 var (
 	// Version of the application
 	Version = "x.y.z-dev"
-	log     = logging.MustGetLogger("sonarcarp")
+	log     = logging.MustGetLogger(config.LogModuleApp)
 )
 
-func startPayloadInBackground(configuration config.Configuration) {
+func startPayloadInBackground(configuration config.Configuration) *payload.Supervisor {
 	log.Infof("Start payload application in background..")
-	log.Debugf("Execute command '%s'", configuration.ApplicationExecCommand)
-	splitted := strings.Split(configuration.ApplicationExecCommand, " ")
-	cmd := exec.Command(splitted[0], splitted[1:]...)
+	supervisor := payload.NewSupervisor(configuration.ApplicationExecCommand, configuration.PayloadStopTimeout)
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatalf("failed to get stdout pipeline: %s", err.Error())
+	if err := supervisor.Start(); err != nil {
+		log.Fatalf("failed to start payload: %s", err.Error())
 		os.Exit(1)
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		log.Fatalf("failed to get stderr pipeline: %s", err.Error())
-		os.Exit(1)
+	return supervisor
+}
+
+// startWatchdog starts the health watchdog. Without a supervisor (proxy-only mode) the watchdog only reports the
+// health of the remote SonarQube.
+func startWatchdog(configuration config.Configuration, supervisor *payload.Supervisor, upstreamTransport http.RoundTripper) {
+	if !configuration.WatchdogEnabled {
+		return
+	}
+
+	var restarter payload.Restarter
+	if supervisor != nil {
+		restarter = supervisor
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Fatalf("failed to start grafana: %s", err.Error())
+	watchdog, err := payload.NewWatchdog(configuration.ServiceUrl, configuration.BaseUrl, restarter, payload.WatchdogOptions{
+		Interval:         configuration.WatchdogInterval,
+		FailureThreshold: configuration.WatchdogFailureThreshold,
+		ProbeTimeout:     configuration.WatchdogProbeTimeout,
+		GracePeriod:      configuration.WatchdogGracePeriod,
+		Transport:        upstreamTransport,
+	})
+	if err != nil {
+		log.Fatalf("failed to create payload watchdog: %s", err.Error())
 		os.Exit(1)
 	}
 
-	go func() {
-		if _, err := io.Copy(os.Stdout, stdout); err != nil {
-			log.Fatalf("failed to pipe stdout output: %s", err.Error())
-			os.Exit(1)
-		}
-	}()
+	go watchdog.Run(context.Background())
+}
+
+// handleLogLevelSignal raises the log levels on each SIGUSR1 and restores the configured levels once all are at DEBUG.
+func handleLogLevelSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
 
 	go func() {
-		if _, err := io.Copy(os.Stdout, stderr); err != nil {
-			log.Fatalf("failed to pipe stderr output: %s", err.Error())
-			os.Exit(1)
-			return
+		for range signals {
+			config.CycleLogLevel()
 		}
 	}()
 }
@@ -67,14 +81,58 @@ func main() {
 
 	log.Infof("start carp in version %s", Version)
 
-	startPayloadInBackground(configuration)
+	handleLogLevelSignal()
+
+	if err = payload.RunPreStartSteps(context.Background(), configuration.PreStart); err != nil {
+		log.Fatalf("aborting startup: %s", err.Error())
+		os.Exit(1)
+	}
+
+	var supervisor *payload.Supervisor
+	if configuration.ProxyOnly {
+		log.Infof("Run in proxy-only mode, expect SonarQube at %s", configuration.ServiceUrl)
+	} else {
+		supervisor = startPayloadInBackground(configuration)
+	}
+
+	upstreamTransport, err := proxy.NewUpstreamTransport(configuration)
+	if err != nil {
+		panic(err)
+	}
+
+	startWatchdog(configuration, supervisor, upstreamTransport)
 
-	server, err := proxy.NewServer(configuration)
+	server, err := proxy.NewServer(configuration, upstreamTransport)
 	if err != nil {
 		panic(err)
 	}
 
-	err = server.ListenAndServe()
+	if redirectServer := proxy.NewRedirectServer(configuration); redirectServer != nil {
+		go func() {
+			log.Infof("Redirect HTTP requests on %s to HTTPS", redirectServer.Addr)
+			redirectErr := redirectServer.ListenAndServe()
+			if redirectErr != nil {
+				log.Errorf("HTTP redirect server stopped: %s", redirectErr.Error())
+			}
+		}()
+	}
+
+	if metricsServer := proxy.NewMetricsServer(configuration); metricsServer != nil {
+		go func() {
+			log.Infof("Expose metrics on %s", metricsServer.Addr)
+			metricsErr := metricsServer.ListenAndServe()
+			if metricsErr != nil {
+				log.Errorf("metrics server stopped: %s", metricsErr.Error())
+			}
+		}()
+	}
+
+	if server.TLSConfig != nil {
+		// the certificate is provided by the TLS config which reloads it on change
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,22 +12,139 @@ import (
 const defaultFileName = "carp.yml"
 
 type Configuration struct {
-	BaseUrl                            string `yaml:"base-url"`
-	CasUrl                             string `yaml:"cas-url"`
-	ServiceUrl                         string `yaml:"service-url"`
-	SkipSSLVerification                bool   `yaml:"skip-ssl-verification"`
-	Port                               int    `yaml:"port"`
-	PrincipalHeader                    string `yaml:"principal-header"`
-	RoleHeader                         string `yaml:"role-header"`
-	MailHeader                         string `yaml:"mail-header"`
-	NameHeader                         string `yaml:"name-header"`
-	LogoutRedirectPath                 string `yaml:"logout-redirect-path"`
-	LogoutPath                         string `yaml:"logout-path"`
-	ForwardUnauthenticatedRESTRequests bool   `yaml:"forward-unauthenticated-rest-requests"`
-	LoggingFormat                      string `yaml:"log-format"`
-	LogLevel                           string `yaml:"log-level"`
-	ApplicationExecCommand             string `yaml:"application-exec-command"`
-	CarpResourcePath                   string `yaml:"carp-resource-path"`
+	BaseUrl                            string                `yaml:"base-url"`
+	CasUrl                             StringList            `yaml:"cas-url"`
+	ServiceUrl                         string                `yaml:"service-url"`
+	SkipSSLVerification                bool                  `yaml:"skip-ssl-verification"`
+	CasCAFile                          string                `yaml:"cas-ca-file"`
+	CasClientCertFile                  string                `yaml:"cas-client-cert-file"`
+	CasClientKeyFile                   string                `yaml:"cas-client-key-file"`
+	CasTimeout                         time.Duration         `yaml:"cas-timeout"`
+	CasRetries                         int                   `yaml:"cas-retries"`
+	CasRetryInterval                   time.Duration         `yaml:"cas-retry-interval"`
+	CasFailoverCooldown                time.Duration         `yaml:"cas-failover-cooldown"`
+	CasServerNames                     map[string]string     `yaml:"cas-server-names"`
+	Port                               int                   `yaml:"port"`
+	TLSCertFile                        string                `yaml:"tls-cert-file"`
+	TLSKeyFile                         string                `yaml:"tls-key-file"`
+	TLSMinVersion                      string                `yaml:"tls-min-version"`
+	TLSCipherSuites                    []string              `yaml:"tls-cipher-suites"`
+	TLSReloadInterval                  time.Duration         `yaml:"tls-reload-interval"`
+	ServerReadHeaderTimeout            time.Duration         `yaml:"server-read-header-timeout"`
+	ServerReadTimeout                  time.Duration         `yaml:"server-read-timeout"`
+	ServerIdleTimeout                  time.Duration         `yaml:"server-idle-timeout"`
+	ServerMaxHeaderBytes               int                   `yaml:"server-max-header-bytes"`
+	MaxRequestBodyBytes                int64                 `yaml:"max-request-body-bytes"`
+	RequestBodyLimits                  []RequestBodyLimit    `yaml:"request-body-limits"`
+	HTTPRedirectPort                   int                   `yaml:"http-redirect-port"`
+	PrincipalHeader                    string                `yaml:"principal-header"`
+	RoleHeader                         string                `yaml:"role-header"`
+	MailHeader                         string                `yaml:"mail-header"`
+	NameHeader                         string                `yaml:"name-header"`
+	LogoutRedirectPath                 string                `yaml:"logout-redirect-path"`
+	LogoutPath                         string                `yaml:"logout-path"`
+	ForwardUnauthenticatedRESTRequests bool                  `yaml:"forward-unauthenticated-rest-requests"`
+	RedirectUnauthenticatedAPIRequests bool                  `yaml:"redirect-unauthenticated-api-requests"`
+	APIRequestPaths                    []string              `yaml:"api-request-paths"`
+	AnonymousPaths                     []PathPattern         `yaml:"anonymous-paths"`
+	GatewayMode                        bool                  `yaml:"gateway-mode"`
+	GatewayLoginPath                   string                `yaml:"gateway-login-path"`
+	GatewayRecheckInterval             time.Duration         `yaml:"gateway-recheck-interval"`
+	ReauthPaths                        []PathPattern         `yaml:"reauth-paths"`
+	ReauthMaxAge                       time.Duration         `yaml:"reauth-max-age"`
+	LoggingFormat                      string                `yaml:"log-format"`
+	LogLevel                           string                `yaml:"log-level"`
+	LogLevels                          map[string]string     `yaml:"log-levels"`
+	LogLevelResetTimeout               time.Duration         `yaml:"log-level-reset-timeout"`
+	LogSinks                           []LogSink             `yaml:"log-sinks"`
+	AuditSink                          *LogSink              `yaml:"audit-sink"`
+	RequestIDHeader                    string                `yaml:"request-id-header"`
+	LogRedactHeaders                   []string              `yaml:"log-redact-headers"`
+	TracingExporter                    string                `yaml:"tracing-exporter"`
+	TracingOtlpEndpoint                string                `yaml:"tracing-otlp-endpoint"`
+	UpstreamDialTimeout                time.Duration         `yaml:"upstream-dial-timeout"`
+	UpstreamTLSHandshakeTimeout        time.Duration         `yaml:"upstream-tls-handshake-timeout"`
+	UpstreamResponseHeaderTimeout      time.Duration         `yaml:"upstream-response-header-timeout"`
+	UpstreamIdleConnTimeout            time.Duration         `yaml:"upstream-idle-conn-timeout"`
+	UpstreamMaxIdleConnsPerHost        int                   `yaml:"upstream-max-idle-conns-per-host"`
+	UpstreamHTTP2                      bool                  `yaml:"upstream-http2"`
+	UpstreamCAFile                     string                `yaml:"upstream-ca-file"`
+	UpstreamClientCertFile             string                `yaml:"upstream-client-cert-file"`
+	UpstreamClientKeyFile              string                `yaml:"upstream-client-key-file"`
+	UpstreamPathTimeouts               []UpstreamPathTimeout `yaml:"upstream-path-timeouts"`
+	ApplicationExecCommand             string                `yaml:"application-exec-command"`
+	ProxyOnly                          bool                  `yaml:"proxy-only"`
+	CarpResourcePath                   string                `yaml:"carp-resource-path"`
+	CarpResourceDir                    string                `yaml:"carp-resource-dir"`
+	StatusPollInterval                 time.Duration         `yaml:"status-poll-interval"`
+	StatusFailureLimit                 int                   `yaml:"status-failure-limit"`
+	CesAdminGroup                      string                `yaml:"ces-admin-group"`
+	PayloadStopTimeout                 time.Duration         `yaml:"payload-stop-timeout"`
+	WatchdogEnabled                    bool                  `yaml:"watchdog-enabled"`
+	WatchdogInterval                   time.Duration         `yaml:"watchdog-interval"`
+	WatchdogFailureThreshold           int                   `yaml:"watchdog-failure-threshold"`
+	WatchdogProbeTimeout               time.Duration         `yaml:"watchdog-probe-timeout"`
+	WatchdogGracePeriod                time.Duration         `yaml:"watchdog-grace-period"`
+	TrustedProxies                     []string              `yaml:"trusted-proxies"`
+	MetricsAddress                     string                `yaml:"metrics-address"`
+	MetricsPath                        string                `yaml:"metrics-path"`
+	PreStart                           []PreStartStep        `yaml:"pre-start"`
+}
+
+// StringList is configured either as a single string or as a list of strings.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+
+	var list []string
+	err := value.Decode(&list)
+	if err != nil {
+		return err
+	}
+
+	*l = list
+	return nil
+}
+
+// PathPattern matches requests by path and method. Path is a path.Match pattern or a prefix ending with /**. Empty
+// Methods match all methods.
+type PathPattern struct {
+	Path    string   `yaml:"path"`
+	Methods []string `yaml:"methods"`
+}
+
+// RequestBodyLimit limits the body size of requests whose path matches PathPattern. The pattern uses the syntax of
+// path.Match, e.g. /sonar/api/*/submit. A negative MaxBytes disables the limit.
+type RequestBodyLimit struct {
+	PathPattern string `yaml:"path-pattern"`
+	MaxBytes    int64  `yaml:"max-bytes"`
+}
+
+// UpstreamPathTimeout overrides the upstream response header timeout for requests whose path starts with PathPrefix.
+type UpstreamPathTimeout struct {
+	PathPrefix string        `yaml:"path-prefix"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// PreStartStep is executed before the payload is started. Exactly one of Command, WaitTCP and WaitHTTP must be set.
+type PreStartStep struct {
+	Name string `yaml:"name"`
+	// Command is the program and its arguments which are executed without shell and must exit successfully. A
+	// single string is the program without arguments.
+	Command StringList `yaml:"command"`
+	// WaitTCP is an address in the form host:port which must accept connections.
+	WaitTCP string `yaml:"wait-tcp"`
+	// WaitHTTP is a URL which must answer with a status code below 400.
+	WaitHTTP string `yaml:"wait-http"`
+	// Timeout limits a single attempt of the step.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is the number of additional attempts if the step fails.
+	Retries       int           `yaml:"retries"`
+	RetryInterval time.Duration `yaml:"retry-interval"`
 }
 
 func InitializeAndReadConfiguration() (Configuration, error) {
@@ -3,9 +3,11 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 const templateConfig = `
@@ -35,6 +37,13 @@ grafana-reader-group: reader
 log-format: "%{time:2006-01-02 15:04:05.000-0700} %{level:.4s} [%{module}:%{shortfile}] %{message}"
 application-exec-command: "exit 0"
 carp-resource-path: /grafana/carp-static
+pre-start:
+  - name: postgres
+    wait-tcp: postgresql:5432
+    timeout: 5s
+    retries: 10
+    retry-interval: 2s
+  - command: /pre-startup.sh
 `
 
 const invalidType = templateConfig + `
@@ -111,7 +120,7 @@ func TestInitializeAndReadConfiguration(t *testing.T) {
 func checkConfig(t *testing.T, config Configuration) {
 	t.Helper()
 	assert.Equal(t, "https://localhost:8080", config.BaseUrl)
-	assert.Equal(t, "https://192.168.56.2/cas", config.CasUrl)
+	assert.Equal(t, StringList{"https://192.168.56.2/cas"}, config.CasUrl)
 	assert.Equal(t, "https://localhost:8080/grafana/login", config.ServiceUrl)
 	assert.Equal(t, "\\/grafana\\/(cas\\/)?logout", config.LogoutPath)
 	assert.Equal(t, true, config.SkipSSLVerification)
@@ -124,4 +133,36 @@ func checkConfig(t *testing.T, config Configuration) {
 	assert.Equal(t, "DEBUG", config.LogLevel)
 	assert.Equal(t, "exit 0", config.ApplicationExecCommand)
 	assert.Equal(t, "/grafana/carp-static", config.CarpResourcePath)
+	assert.Equal(t, []PreStartStep{
+		{Name: "postgres", WaitTCP: "postgresql:5432", Timeout: 5 * time.Second, Retries: 10, RetryInterval: 2 * time.Second},
+		{Command: StringList{"/pre-startup.sh"}},
+	}, config.PreStart)
+}
+
+func TestStringList_UnmarshalYAML(t *testing.T) {
+	t.Run("single string", func(t *testing.T) {
+		var config Configuration
+
+		err := yaml.Unmarshal([]byte("cas-url: https://cas1/cas"), &config)
+
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"https://cas1/cas"}, config.CasUrl)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var config Configuration
+
+		err := yaml.Unmarshal([]byte("cas-url:\n  - https://cas1/cas\n  - https://cas2/cas"), &config)
+
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"https://cas1/cas", "https://cas2/cas"}, config.CasUrl)
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		var config Configuration
+
+		err := yaml.Unmarshal([]byte("cas-url:\n  url: https://cas1/cas"), &config)
+
+		assert.Error(t, err)
+	})
 }
@@ -2,4 +2,4 @@ package config
 
 import "github.com/op/go-logging"
 
-var log = logging.MustGetLogger("sonarcarp")
+var log = logging.MustGetLogger(LogModuleConfig)
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/op/go-logging"
+)
+
+const jsonLogFormat = "json"
+
+// jsonFormatter renders each log record as a single JSON object.
+type jsonFormatter struct{}
+
+func (f jsonFormatter) Format(calldepth int, r *logging.Record, output io.Writer) error {
+	message := r.Message()
+
+	entry := map[string]string{}
+	if fields, ok := internal.FindLogFields(r.Args); ok {
+		message = strings.TrimSuffix(message, " "+fields.String())
+		for key, value := range fields {
+			entry[key] = value
+		}
+	}
+
+	entry["time"] = r.Time.Format(time.RFC3339Nano)
+	entry["level"] = r.Level.String()
+	entry["module"] = r.Module
+	entry["caller"] = caller(calldepth + 1)
+	entry["message"] = message
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log record: %w", err)
+	}
+
+	_, err = output.Write(data)
+	return err
+}
+
+func caller(calldepth int) string {
+	_, file, line, ok := runtime.Caller(calldepth + 1)
+	if !ok {
+		return "???:0"
+	}
+
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
@@ -1,36 +1,142 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
-	"github.com/op/go-logging"
-	"os"
+	"io"
 	"slices"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
 )
 
-func initLogger(configuration Configuration) error {
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
+// Logical log modules which can get their own log level with the log-levels option.
+const (
+	LogModuleApp     = "sonarcarp"
+	LogModuleProxy   = "proxy"
+	LogModuleCas     = "cas"
+	LogModulePayload = "payload"
+	LogModuleConfig  = "config"
+	LogModuleAccess  = "access"
+	// LogModuleAudit records security relevant events. It always logs at INFO level to the audit sink.
+	LogModuleAudit = "audit"
+)
 
-	var format = logging.MustStringFormatter(configuration.LoggingFormat)
-	formatter := logging.NewBackendFormatter(backend, format)
+var logModules = []string{LogModuleApp, LogModuleProxy, LogModuleCas, LogModulePayload, LogModuleConfig, LogModuleAccess}
+
+var logLevelNames = []string{"CRITICAL", "ERROR", "WARN", "NOTICE", "INFO", "DEBUG"}
+
+func initLogger(configuration Configuration) error {
+	redactor := newRedactor(configuration.LogRedactHeaders)
+	formatter := redactingFormatter{formatter: createFormatter(configuration.LoggingFormat), redactor: redactor}
+	backend, err := createLogBackend(configuration.LogSinks, formatter, configuration.AuditSink)
+	if err != nil {
+		return fmt.Errorf("unable to create log sinks: %w", err)
+	}
 
 	level, err := convertLogLevel(configuration.LogLevel)
 	if err != nil {
 		return fmt.Errorf("unable to convert level: %s, to loglevel: %w", configuration.LogLevel, err)
 	}
 
-	backendLeveled := logging.AddModuleLevel(formatter)
-	backendLeveled.SetLevel(level, "")
+	backend = redactingBackend{backend: backend, redactor: redactor}
+	backendLeveled := logging.AddModuleLevel(eventTimeBackend{backend: backend})
+	backendLeveled.SetLevel(level, globalLogModule)
+	configuredLevels := map[string]logging.Level{globalLogModule: level}
+
+	for module, moduleLogLevel := range configuration.LogLevels {
+		if !slices.Contains(logModules, module) {
+			return fmt.Errorf("unknown log module '%s', only %s are allowed", module, strings.Join(logModules, ", "))
+		}
+
+		moduleLevel, err := convertLogLevel(moduleLogLevel)
+		if err != nil {
+			return fmt.Errorf("unable to convert level: %s of module %s, to loglevel: %w", moduleLogLevel, module, err)
+		}
+
+		backendLeveled.SetLevel(moduleLevel, module)
+		configuredLevels[module] = moduleLevel
+	}
+
+	backendLeveled.SetLevel(logging.INFO, LogModuleAudit)
 
 	logging.SetBackend(backendLeveled)
+	runtimeLevels.setConfigured(configuredLevels)
 
-	log.Infof("Initialized logger with log-level: %s", level)
+	log.Infof("Initialized logger with log-level: %s and module log-levels: %v", level, configuration.LogLevels)
 
 	return nil
 }
 
+// TimedMessage is a log argument for events which happened before they are logged, like lines of the payload output.
+// The record of a message logged with a TimedMessage carries the time of the event instead of the time of logging.
+type TimedMessage struct {
+	Time    time.Time
+	Message string
+}
+
+func (m TimedMessage) String() string {
+	return m.Message
+}
+
+// eventTimeBackend stamps records with the time of their TimedMessage argument before they are formatted.
+type eventTimeBackend struct {
+	backend logging.Backend
+}
+
+func (b eventTimeBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	for _, arg := range rec.Args {
+		if message, ok := arg.(TimedMessage); ok && !message.Time.IsZero() {
+			rec.Time = message.Time
+		}
+	}
+
+	return b.backend.Log(level, calldepth+1, rec)
+}
+
+// redactingBackend masks sensitive values of all records before they are formatted, so that secrets are neither
+// logged in text, JSON nor syslog format.
+type redactingBackend struct {
+	backend  logging.Backend
+	redactor redactor
+}
+
+func (b redactingBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	rec.Args = b.redactor.Args(rec.Args)
+
+	return b.backend.Log(level, calldepth+1, rec)
+}
+
+// redactingFormatter masks sensitive values in the formatted message, so that secrets in the format string of a
+// record are not logged in clear either.
+type redactingFormatter struct {
+	formatter logging.Formatter
+	redactor  redactor
+}
+
+func (f redactingFormatter) Format(calldepth int, rec *logging.Record, writer io.Writer) error {
+	var buf bytes.Buffer
+	if err := f.formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(writer, f.redactor.Text(buf.String()))
+	return err
+}
+
+func createFormatter(format string) logging.Formatter {
+	if format == jsonLogFormat {
+		return jsonFormatter{}
+	}
+
+	return logging.MustStringFormatter(format)
+}
+
 func convertLogLevel(logLevel string) (logging.Level, error) {
-	if !slices.Contains([]string{"DEBUG", "WARN", "INFO", "ERROR"}, logLevel) {
-		return 0, fmt.Errorf("the log level '%s' was not found, only WARN, DEBUG, INFO and ERROR are allowed", logLevel)
+	logLevel = strings.ToUpper(strings.TrimSpace(logLevel))
+	if !slices.Contains(logLevelNames, logLevel) {
+		return 0, fmt.Errorf("the log level '%s' was not found, only %s are allowed", logLevel, strings.Join(logLevelNames, ", "))
 	}
 	switch logLevel {
 	case "WARN":
@@ -1,8 +1,15 @@
 package config
 
 import (
-	"github.com/stretchr/testify/assert"
+	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPreparesLoggerSuccessfully(t *testing.T) {
@@ -28,3 +35,122 @@ func TestFailOnInvalidLogLevel(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "WARNING")
 }
+
+func TestCanHandleJsonFormat(t *testing.T) {
+	err := initLogger(Configuration{
+		LoggingFormat: "json",
+		LogLevel:      "INFO",
+	})
+	assert.Nil(t, err)
+}
+
+func TestJsonFormatter_Format(t *testing.T) {
+	t.Run("format record as json", func(t *testing.T) {
+		var buf bytes.Buffer
+		backend := logging.NewLogBackend(&buf, "", 0)
+		logger := logging.MustGetLogger("proxy")
+		logger.SetBackend(logging.AddModuleLevel(logging.NewBackendFormatter(backend, jsonFormatter{})))
+
+		logger.Infof("200 GET /sonar %v", internal.LogFields{"path": "/sonar", "principal": "admin"})
+
+		var entry map[string]string
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		assert.Equal(t, "INFO", entry["level"])
+		assert.Equal(t, "proxy", entry["module"])
+		assert.Equal(t, "200 GET /sonar", entry["message"])
+		assert.Equal(t, "/sonar", entry["path"])
+		assert.Equal(t, "admin", entry["principal"])
+		assert.Contains(t, entry["caller"], "logging_test.go:")
+		assert.NotEmpty(t, entry["time"])
+	})
+
+	t.Run("reserved keys win over fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		backend := logging.NewLogBackend(&buf, "", 0)
+		logger := logging.MustGetLogger("proxy")
+		logger.SetBackend(logging.AddModuleLevel(logging.NewBackendFormatter(backend, jsonFormatter{})))
+
+		logger.Warningf("something happened %v", internal.LogFields{"level": "DEBUG"})
+
+		var entry map[string]string
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		assert.Equal(t, "WARNING", entry["level"])
+		assert.Equal(t, "something happened", entry["message"])
+	})
+}
+
+func TestEventTimeBackend_Log(t *testing.T) {
+	var buf bytes.Buffer
+	backend := logging.NewBackendFormatter(logging.NewLogBackend(&buf, "", 0), jsonFormatter{})
+	logger := logging.MustGetLogger("payload")
+	logger.SetBackend(logging.AddModuleLevel(eventTimeBackend{backend: backend}))
+	eventTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	logger.Infof("%s", TimedMessage{Time: eventTime, Message: "web[][o.s.s.p.Platform] Web Server is operational"})
+
+	var entry map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "2025-01-01T12:00:00Z", entry["time"])
+	assert.Equal(t, "web[][o.s.s.p.Platform] Web Server is operational", entry["message"])
+}
+
+func TestConvertLogLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected logging.Level
+	}{
+		{"CRITICAL", logging.CRITICAL},
+		{"error", logging.ERROR},
+		{"Warn", logging.WARNING},
+		{"notice", logging.NOTICE},
+		{" INFO ", logging.INFO},
+		{"debug", logging.DEBUG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := convertLogLevel(tt.input)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+func TestSetsModuleLogLevels(t *testing.T) {
+	err := initLogger(Configuration{
+		LoggingFormat: "%{message}",
+		LogLevel:      "INFO",
+		LogLevels: map[string]string{
+			LogModuleCas:     "debug",
+			LogModulePayload: "ERROR",
+		},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, logging.INFO, logging.GetLevel(LogModuleProxy))
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModuleCas))
+	assert.Equal(t, logging.ERROR, logging.GetLevel(LogModulePayload))
+}
+
+func TestFailOnUnknownLogModule(t *testing.T) {
+	err := initLogger(Configuration{
+		LoggingFormat: "%{message}",
+		LogLevel:      "INFO",
+		LogLevels:     map[string]string{"ldap": "DEBUG"},
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown log module 'ldap'")
+}
+
+func TestFailOnInvalidModuleLogLevel(t *testing.T) {
+	err := initLogger(Configuration{
+		LoggingFormat: "%{message}",
+		LogLevel:      "INFO",
+		LogLevels:     map[string]string{LogModuleCas: "TRACE"},
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TRACE")
+}
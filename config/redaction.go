@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedHeaders contain credentials or session identifiers and are never logged in clear text.
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactedQueryParameters carry CAS service tickets, proxy tickets and proxy granting tickets.
+var redactedQueryParameters = []string{"ticket", "pgt", "pgtId", "pgtIou", "proxyTicket"}
+
+// redactedTextPatterns find secrets in free text like error messages. The first group of a pattern is kept.
+var redactedTextPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`([?&](?:ticket|pgt|pgtId|pgtIou|proxyTicket)=)[^&#\s"']+`),
+	regexp.MustCompile(`()\b(?:ST|PT|PGT|PGTIOU|TGT)-\d+-[\w.-]+`),
+	regexp.MustCompile(`(?i)(\b(?:Basic|Bearer) )[\w.~+/=-]+`),
+	regexp.MustCompile(`(_cas_session=)[^;\s"']+`),
+}
+
+type redactor struct {
+	headers map[string]struct{}
+}
+
+func newRedactor(additionalHeaders []string) redactor {
+	headers := map[string]struct{}{}
+	for _, header := range slices.Concat(defaultRedactedHeaders, additionalHeaders) {
+		headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+
+	return redactor{headers: headers}
+}
+
+// Header returns a copy of the header with masked values for all sensitive headers.
+func (r redactor) Header(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		if _, ok := r.headers[http.CanonicalHeaderKey(key)]; ok {
+			redacted[key] = []string{redactedValue}
+			continue
+		}
+		redacted[key] = values
+	}
+
+	return redacted
+}
+
+// URL returns a copy of the URL with masked CAS tickets.
+func (r redactor) URL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+
+	query := u.Query()
+	changed := false
+	for _, parameter := range redactedQueryParameters {
+		if query.Has(parameter) {
+			query.Set(parameter, redactedValue)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return u
+	}
+
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+
+	return &redacted
+}
+
+// Text masks CAS tickets, credentials and session cookies in free text.
+func (r redactor) Text(text string) string {
+	for _, pattern := range redactedTextPatterns {
+		text = pattern.ReplaceAllString(text, "${1}"+redactedValue)
+	}
+
+	return text
+}
+
+// Args returns copies of the log arguments with masked values. Arguments keep their type so that they are formatted
+// as before.
+func (r redactor) Args(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case string:
+			redacted[i] = r.Text(value)
+		case http.Header:
+			redacted[i] = r.Header(value)
+		case *url.URL:
+			redacted[i] = r.URL(value)
+		case internal.LogFields:
+			fields := make(internal.LogFields, len(value))
+			for key, field := range value {
+				fields[key] = r.Text(field)
+			}
+			redacted[i] = fields
+		case TimedMessage:
+			redacted[i] = TimedMessage{Time: value.Time, Message: r.Text(value.Message)}
+		case error:
+			redacted[i] = errors.New(r.Text(value.Error()))
+		default:
+			redacted[i] = arg
+		}
+	}
+
+	return redacted
+}
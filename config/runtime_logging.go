@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+const globalLogModule = ""
+
+// runtimeLogLevels keeps the configured log levels so that levels changed at runtime can be restored. Levels raised
+// by CycleLogLevel are always derived from the configured ones.
+type runtimeLogLevels struct {
+	mu         sync.Mutex
+	configured map[string]logging.Level
+	raised     int
+	timers     map[string]*time.Timer
+}
+
+var runtimeLevels = &runtimeLogLevels{
+	configured: map[string]logging.Level{},
+	timers:     map[string]*time.Timer{},
+}
+
+func (r *runtimeLogLevels) setConfigured(levels map[string]logging.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, timer := range r.timers {
+		timer.Stop()
+	}
+
+	r.configured = levels
+	r.raised = 0
+	r.timers = map[string]*time.Timer{}
+}
+
+func (r *runtimeLogLevels) configuredLevel(module string) logging.Level {
+	if level, ok := r.configured[module]; ok {
+		return level
+	}
+
+	return r.configured[globalLogModule]
+}
+
+// level returns the configured level of the module raised by the steps of CycleLogLevel.
+func (r *runtimeLogLevels) level(module string) logging.Level {
+	level := r.configuredLevel(module) + logging.Level(r.raised)
+	if level > logging.DEBUG {
+		return logging.DEBUG
+	}
+
+	return level
+}
+
+// allAtDebug reports whether the raised levels of all modules reached DEBUG.
+func (r *runtimeLogLevels) allAtDebug() bool {
+	for _, module := range append([]string{globalLogModule}, logModules...) {
+		if r.level(module) != logging.DEBUG {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CycleLogLevel raises the configured log level of all modules by one more step. Once every module reached DEBUG, the
+// next call restores the configured levels. Modules whose level was set temporarily by SetModuleLogLevel keep it.
+func CycleLogLevel() {
+	runtimeLevels.mu.Lock()
+	defer runtimeLevels.mu.Unlock()
+
+	if runtimeLevels.allAtDebug() {
+		runtimeLevels.raised = 0
+	} else {
+		runtimeLevels.raised++
+	}
+
+	for _, module := range append([]string{globalLogModule}, logModules...) {
+		if _, ok := runtimeLevels.timers[module]; ok {
+			continue
+		}
+		logging.SetLevel(runtimeLevels.level(module), module)
+	}
+
+	if runtimeLevels.raised == 0 {
+		log.Noticef("Restored configured log levels")
+		return
+	}
+	log.Noticef("Raised log levels to %v", ModuleLogLevels())
+}
+
+// SetModuleLogLevel changes the log level of a module and restores the configured level after revertAfter.
+func SetModuleLogLevel(module string, logLevel string, revertAfter time.Duration) error {
+	if !slices.Contains(logModules, module) {
+		return fmt.Errorf("unknown log module '%s', only %s are allowed", module, strings.Join(logModules, ", "))
+	}
+
+	level, err := convertLogLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	runtimeLevels.mu.Lock()
+	defer runtimeLevels.mu.Unlock()
+
+	if timer, ok := runtimeLevels.timers[module]; ok {
+		timer.Stop()
+	}
+
+	logging.SetLevel(level, module)
+	log.Noticef("Set log level of module %s to %s for %s", module, levelName(level), revertAfter)
+
+	runtimeLevels.timers[module] = time.AfterFunc(revertAfter, func() {
+		runtimeLevels.mu.Lock()
+		defer runtimeLevels.mu.Unlock()
+
+		restored := runtimeLevels.level(module)
+		logging.SetLevel(restored, module)
+		delete(runtimeLevels.timers, module)
+		log.Noticef("Restored log level of module %s to %s", module, levelName(restored))
+	})
+
+	return nil
+}
+
+// ModuleLogLevels returns the current log level of every module.
+func ModuleLogLevels() map[string]string {
+	levels := map[string]string{}
+	for _, module := range logModules {
+		levels[module] = levelName(logging.GetLevel(module))
+	}
+
+	return levels
+}
+
+func levelName(level logging.Level) string {
+	if level == logging.WARNING {
+		return "WARN"
+	}
+
+	return level.String()
+}
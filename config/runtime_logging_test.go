@@ -0,0 +1,116 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initTestLogger(t *testing.T, levels map[string]string) {
+	t.Helper()
+
+	err := initLogger(Configuration{
+		LoggingFormat: "%{message}",
+		LogLevel:      "WARN",
+		LogLevels:     levels,
+	})
+	require.NoError(t, err)
+}
+
+func TestCycleLogLevel(t *testing.T) {
+	initTestLogger(t, map[string]string{LogModulePayload: "ERROR"})
+
+	CycleLogLevel()
+	assert.Equal(t, logging.NOTICE, logging.GetLevel(LogModuleProxy))
+	assert.Equal(t, logging.WARNING, logging.GetLevel(LogModulePayload))
+
+	CycleLogLevel()
+	CycleLogLevel()
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModuleProxy))
+	assert.Equal(t, logging.INFO, logging.GetLevel(LogModulePayload))
+
+	CycleLogLevel()
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModuleProxy))
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModulePayload))
+
+	CycleLogLevel()
+	assert.Equal(t, logging.WARNING, logging.GetLevel(LogModuleProxy))
+	assert.Equal(t, logging.ERROR, logging.GetLevel(LogModulePayload))
+}
+
+func TestCycleLogLevel_raisesModulesBelowGlobalDebug(t *testing.T) {
+	err := initLogger(Configuration{
+		LoggingFormat: "%{message}",
+		LogLevel:      "DEBUG",
+		LogLevels:     map[string]string{LogModulePayload: "INFO"},
+	})
+	require.NoError(t, err)
+
+	CycleLogLevel()
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModulePayload))
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModuleProxy))
+
+	CycleLogLevel()
+	assert.Equal(t, logging.INFO, logging.GetLevel(LogModulePayload))
+}
+
+func TestCycleLogLevel_derivesLevelsFromConfiguration(t *testing.T) {
+	initTestLogger(t, map[string]string{LogModulePayload: "ERROR", LogModuleCas: "DEBUG"})
+
+	// levels changed in between must not shift the following steps
+	logging.SetLevel(logging.CRITICAL, LogModulePayload)
+	CycleLogLevel()
+	assert.Equal(t, logging.WARNING, logging.GetLevel(LogModulePayload))
+	assert.Equal(t, logging.DEBUG, logging.GetLevel(LogModuleCas))
+
+	logging.SetLevel(logging.DEBUG, LogModulePayload)
+	CycleLogLevel()
+	assert.Equal(t, logging.NOTICE, logging.GetLevel(LogModulePayload))
+	assert.Equal(t, logging.INFO, logging.GetLevel(LogModuleProxy))
+}
+
+func TestCycleLogLevel_keepsTemporaryModuleLevel(t *testing.T) {
+	initTestLogger(t, nil)
+	require.NoError(t, SetModuleLogLevel(LogModuleCas, "ERROR", time.Minute))
+
+	CycleLogLevel()
+
+	assert.Equal(t, logging.ERROR, logging.GetLevel(LogModuleCas))
+	assert.Equal(t, logging.NOTICE, logging.GetLevel(LogModuleProxy))
+}
+
+func TestSetModuleLogLevel(t *testing.T) {
+	t.Run("set level and revert after timeout", func(t *testing.T) {
+		initTestLogger(t, nil)
+
+		err := SetModuleLogLevel(LogModuleCas, "debug", 20*time.Millisecond)
+
+		require.NoError(t, err)
+		assert.Equal(t, "DEBUG", ModuleLogLevels()[LogModuleCas])
+		assert.Equal(t, "WARN", ModuleLogLevels()[LogModuleProxy])
+		assert.Eventually(t, func() bool {
+			return ModuleLogLevels()[LogModuleCas] == "WARN"
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("fail on unknown module", func(t *testing.T) {
+		initTestLogger(t, nil)
+
+		err := SetModuleLogLevel("ldap", "DEBUG", time.Minute)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown log module 'ldap'")
+	})
+
+	t.Run("fail on invalid level", func(t *testing.T) {
+		initTestLogger(t, nil)
+
+		err := SetModuleLogLevel(LogModuleCas, "TRACE", time.Minute)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "TRACE")
+	})
+}
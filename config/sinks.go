@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/op/go-logging"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	logSinkStderr = "stderr"
+	logSinkFile   = "file"
+	logSinkSyslog = "syslog"
+)
+
+// LogSink is a destination for log records. Records of all modules except the audit module are written to a sink
+// unless Modules restricts it to some of them.
+type LogSink struct {
+	Type    string   `yaml:"type"`
+	Modules []string `yaml:"modules"`
+	// Path of the log file for file sinks.
+	Path string `yaml:"path"`
+	// MaxSizeMB is the size in megabytes after which a log file is rotated.
+	MaxSizeMB int `yaml:"max-size-mb"`
+	// RotateInterval rotates the log file periodically regardless of its size.
+	RotateInterval time.Duration `yaml:"rotate-interval"`
+	// MaxAge is the retention time of rotated log files.
+	MaxAge     time.Duration `yaml:"max-age"`
+	MaxBackups int           `yaml:"max-backups"`
+	Compress   bool          `yaml:"compress"`
+	// Network is one of udp, tcp and unix for syslog sinks.
+	Network string `yaml:"network"`
+	// Address of the syslog server, a socket path for unix.
+	Address string `yaml:"address"`
+	// Tag is the syslog APP-NAME, defaults to sonarcarp.
+	Tag string `yaml:"tag"`
+}
+
+type sinkBackend struct {
+	modules []string
+	backend logging.Backend
+}
+
+// routingBackend passes each record to the sinks which accept the record's module.
+type routingBackend struct {
+	sinks []sinkBackend
+}
+
+func (r routingBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	var lastErr error
+	for _, sink := range r.sinks {
+		if len(sink.modules) == 0 && rec.Module == LogModuleAudit {
+			// audit records are only written to the audit sink
+			continue
+		}
+
+		if len(sink.modules) != 0 && !slices.Contains(sink.modules, rec.Module) {
+			continue
+		}
+
+		if err := sink.backend.Log(level, calldepth+1, rec); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func createLogBackend(sinks []LogSink, formatter logging.Formatter, auditSink *LogSink) (logging.Backend, error) {
+	if len(sinks) == 0 {
+		sinks = []LogSink{{Type: logSinkStderr}}
+	}
+
+	router := routingBackend{}
+	for i, sink := range sinks {
+		for _, module := range sink.Modules {
+			if !slices.Contains(logModules, module) {
+				return nil, fmt.Errorf("unknown log module '%s' in log sink #%d", module, i+1)
+			}
+		}
+
+		backend, err := createSinkBackend(sink, formatter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log sink #%d of type '%s': %w", i+1, sink.Type, err)
+		}
+
+		router.sinks = append(router.sinks, sinkBackend{modules: sink.Modules, backend: backend})
+	}
+
+	if auditSink == nil {
+		auditSink = &LogSink{Type: logSinkStderr}
+	}
+
+	// audit records are already formatted as JSON lines
+	backend, err := createSinkBackend(*auditSink, logging.MustStringFormatter("%{message}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log sink of type '%s': %w", auditSink.Type, err)
+	}
+	router.sinks = append(router.sinks, sinkBackend{modules: []string{LogModuleAudit}, backend: backend})
+
+	return router, nil
+}
+
+func createSinkBackend(sink LogSink, formatter logging.Formatter) (logging.Backend, error) {
+	switch sink.Type {
+	case logSinkStderr, "":
+		return logging.NewBackendFormatter(logging.NewLogBackend(os.Stderr, "", 0), formatter), nil
+	case logSinkFile:
+		writer, err := createRotatingFile(sink)
+		if err != nil {
+			return nil, err
+		}
+		return logging.NewBackendFormatter(logging.NewLogBackend(writer, "", 0), formatter), nil
+	case logSinkSyslog:
+		backend, err := newSyslogBackend(sink.Network, sink.Address, sink.Tag)
+		if err != nil {
+			return nil, err
+		}
+		return logging.NewBackendFormatter(backend, formatter), nil
+	default:
+		return nil, fmt.Errorf("unknown log sink type '%s', only %s, %s and %s are allowed", sink.Type, logSinkStderr, logSinkFile, logSinkSyslog)
+	}
+}
+
+func createRotatingFile(sink LogSink) (io.Writer, error) {
+	if sink.Path == "" {
+		return nil, fmt.Errorf("file log sink needs a path")
+	}
+
+	logFile := &lumberjack.Logger{
+		Filename:   sink.Path,
+		MaxSize:    sink.MaxSizeMB,
+		MaxAge:     int(math.Ceil(sink.MaxAge.Hours() / 24)),
+		MaxBackups: sink.MaxBackups,
+		Compress:   sink.Compress,
+	}
+
+	if sink.RotateInterval > 0 {
+		go rotatePeriodically(logFile, sink.RotateInterval)
+	}
+
+	return logFile, nil
+}
+
+func rotatePeriodically(logFile *lumberjack.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := logFile.Rotate(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %s\n", logFile.Filename, err.Error())
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLogBackend(t *testing.T) {
+	t.Run("route modules to file and all others to stderr", func(t *testing.T) {
+		accessLogFile := filepath.Join(t.TempDir(), "access.log")
+		backend, err := createLogBackend([]LogSink{
+			{Type: "file", Path: accessLogFile, Modules: []string{LogModuleAccess}},
+			{Type: "stderr", Modules: []string{LogModuleProxy}},
+		}, logging.MustStringFormatter("%{module} %{message}"), nil)
+		require.NoError(t, err)
+
+		logging.SetBackend(backend).SetLevel(logging.DEBUG, "")
+		accessLogger := logging.MustGetLogger(LogModuleAccess)
+		payloadLogger := logging.MustGetLogger(LogModulePayload)
+
+		accessLogger.Infof("200 GET /sonar")
+		payloadLogger.Infof("not routed")
+
+		content, err := os.ReadFile(accessLogFile)
+		require.NoError(t, err)
+		assert.Equal(t, "access 200 GET /sonar\n", string(content))
+	})
+
+	t.Run("fail on unknown sink type", func(t *testing.T) {
+		_, err := createLogBackend([]LogSink{{Type: "kafka"}}, logging.MustStringFormatter("%{message}"), nil)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown log sink type 'kafka'")
+	})
+
+	t.Run("fail on unknown module", func(t *testing.T) {
+		_, err := createLogBackend([]LogSink{{Type: "stderr", Modules: []string{"ldap"}}}, logging.MustStringFormatter("%{message}"), nil)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown log module 'ldap'")
+	})
+
+	t.Run("fail on file sink without path", func(t *testing.T) {
+		_, err := createLogBackend([]LogSink{{Type: "file"}}, logging.MustStringFormatter("%{message}"), nil)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "needs a path")
+	})
+}
+
+func TestSyslogBackend(t *testing.T) {
+	t.Run("send rfc 5424 message over udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		backend, err := createLogBackend([]LogSink{
+			{Type: "syslog", Network: "udp", Address: conn.LocalAddr().String(), Tag: "carp"},
+		}, logging.MustStringFormatter("%{message}"), nil)
+		require.NoError(t, err)
+		logging.SetBackend(backend).SetLevel(logging.DEBUG, "")
+		logger := logging.MustGetLogger(LogModuleProxy)
+
+		logger.Warningf("upstream is slow")
+
+		buffer := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buffer)
+		require.NoError(t, err)
+
+		message := string(buffer[:n])
+		// local0 (16) * 8 + warning (4)
+		assert.True(t, strings.HasPrefix(message, "<132>1 "), message)
+		assert.Contains(t, message, " carp ")
+		assert.True(t, strings.HasSuffix(message, " - - upstream is slow"), message)
+	})
+
+	t.Run("send octet counted message over tcp", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		received := make(chan string, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			reader := bufio.NewReader(conn)
+			length, _ := reader.ReadString(' ')
+			size, _ := strconv.Atoi(strings.TrimSpace(length))
+			message := make([]byte, size)
+			_, _ = io.ReadFull(reader, message)
+			received <- string(message)
+		}()
+
+		backend, err := createLogBackend([]LogSink{
+			{Type: "syslog", Network: "tcp", Address: listener.Addr().String()},
+		}, logging.MustStringFormatter("%{message}"), nil)
+		require.NoError(t, err)
+		logging.SetBackend(backend).SetLevel(logging.DEBUG, "")
+		logger := logging.MustGetLogger(LogModuleProxy)
+
+		logger.Errorf("upstream is down")
+
+		select {
+		case message := <-received:
+			// local0 (16) * 8 + error (3)
+			assert.True(t, strings.HasPrefix(message, "<131>1 "), message)
+			assert.Contains(t, message, " sonarcarp ")
+			assert.True(t, strings.HasSuffix(message, " - - upstream is down"), message)
+		case <-time.After(time.Second):
+			t.Fatal("no syslog message received")
+		}
+	})
+
+	t.Run("truncate large message and keep sending", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		backend, err := createLogBackend([]LogSink{
+			{Type: "syslog", Network: "udp", Address: conn.LocalAddr().String()},
+		}, logging.MustStringFormatter("%{message}"), nil)
+		require.NoError(t, err)
+		logging.SetBackend(backend).SetLevel(logging.DEBUG, "")
+		logger := logging.MustGetLogger(LogModuleProxy)
+
+		logger.Info(strings.Repeat("x", 70*1024))
+		logger.Info("small message")
+
+		buffer := make([]byte, 128*1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buffer)
+		require.NoError(t, err)
+		assert.Equal(t, syslogMaxMessageSize, n)
+		n, _, err = conn.ReadFrom(buffer)
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(string(buffer[:n]), " - - small message"))
+	})
+
+	t.Run("send octet counted message over unix socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "syslog.sock")
+		listener, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		defer listener.Close()
+
+		backend, err := createLogBackend([]LogSink{
+			{Type: "syslog", Network: "unix", Address: socket},
+		}, logging.MustStringFormatter("%{message}"), nil)
+		require.NoError(t, err)
+		logging.SetBackend(backend).SetLevel(logging.DEBUG, "")
+		logging.MustGetLogger(LogModuleProxy).Info("hello")
+
+		require.NoError(t, listener.(*net.UnixListener).SetDeadline(time.Now().Add(time.Second)))
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		reader := bufio.NewReader(conn)
+		length, err := reader.ReadString(' ')
+		require.NoError(t, err)
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		require.NoError(t, err)
+		message := make([]byte, size)
+		_, err = io.ReadFull(reader, message)
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(string(message), " - - hello"), string(message))
+	})
+
+	t.Run("connect lazily to syslog server", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		backend, err := newSyslogBackend("tcp", address, "")
+		require.NoError(t, err, "the syslog server must not be needed at startup")
+
+		listener, err = net.Listen("tcp", address)
+		require.NoError(t, err)
+		defer listener.Close()
+
+		formatted := logging.NewBackendFormatter(backend, logging.MustStringFormatter("%{message}"))
+		require.NoError(t, formatted.Log(logging.INFO, 0, &logging.Record{Time: time.Now(), Module: LogModuleProxy, Level: logging.INFO}))
+
+		require.NoError(t, listener.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second)))
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+
+	t.Run("drop messages instead of blocking while syslog server is unreachable", func(t *testing.T) {
+		backend, err := newSyslogBackend("tcp", "127.0.0.1:1", "")
+		require.NoError(t, err)
+
+		formatted := logging.NewBackendFormatter(backend, logging.MustStringFormatter("%{message}"))
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < syslogQueueSize+10; i++ {
+				_ = formatted.Log(logging.INFO, 0, &logging.Record{Time: time.Now(), Module: LogModuleProxy, Level: logging.INFO})
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			assert.Positive(t, backend.dropped.Load())
+		case <-time.After(time.Second):
+			t.Fatal("logging blocked on unreachable syslog server")
+		}
+	})
+
+	t.Run("fail on unknown network", func(t *testing.T) {
+		_, err := newSyslogBackend("http", "localhost:514", "")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown syslog network 'http'")
+	})
+}
+
+func TestTruncateMessage(t *testing.T) {
+	assert.Equal(t, "short", truncateMessage("short", 10))
+	assert.Equal(t, "abc", truncateMessage("abcdef", 3))
+	assert.Equal(t, "ab", truncateMessage("abäd", 3), "must not split a multi-byte character")
+}
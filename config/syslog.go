@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/op/go-logging"
+)
+
+const (
+	defaultSyslogTag = "sonarcarp"
+	// syslogFacilityLocal0 is used for all messages of carp.
+	syslogFacilityLocal0    = 16
+	syslogDialTimeout       = 5 * time.Second
+	syslogReconnectInterval = 5 * time.Second
+	// syslogQueueSize is the number of messages which are kept while the syslog server is unreachable.
+	syslogQueueSize = 1000
+	// syslogMaxMessageSize is the default message size limit of rsyslog. Longer messages are truncated, so that they
+	// fit into a datagram.
+	syslogMaxMessageSize = 8192
+	// syslogWriteAttempts is the number of times a message is written before it is dropped.
+	syslogWriteAttempts = 2
+)
+
+// syslogBackend sends log records as RFC 5424 messages to a syslog server. Messages over stream sockets (tcp and
+// unix) are framed by octet counting as described in RFC 6587. Messages are sent in background, so that logging never
+// waits for the server. While the server is unreachable, messages are queued up to syslogQueueSize and dropped
+// afterwards.
+type syslogBackend struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+
+	messages chan []byte
+	dropped  atomic.Int64
+	lastDial time.Time
+}
+
+func newSyslogBackend(network string, address string, tag string) (*syslogBackend, error) {
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unknown syslog network '%s', only udp, tcp, unix and unixgram are allowed", network)
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("syslog log sink needs an address")
+	}
+
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	backend := &syslogBackend{
+		network:  network,
+		address:  address,
+		tag:      tag,
+		hostname: hostname,
+		messages: make(chan []byte, syslogQueueSize),
+	}
+	go backend.send()
+
+	return backend, nil
+}
+
+func (s *syslogBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	message := s.format(level, rec.Time, strings.TrimSuffix(rec.Formatted(calldepth+1), "\n"))
+
+	select {
+	case s.messages <- message:
+	default:
+		s.dropped.Add(1)
+	}
+
+	return nil
+}
+
+// send writes the queued messages to the syslog server. It connects lazily and reconnects after write errors, because
+// the server may have closed the connection. A message which cannot be written syslogWriteAttempts times or is too
+// large for the socket is dropped, so that it does not hold back the following messages.
+func (s *syslogBackend) send() {
+	var conn net.Conn
+
+	for message := range s.messages {
+		for attempt := 1; ; attempt++ {
+			if conn == nil {
+				conn = s.connect()
+			}
+
+			_, err := conn.Write(message)
+			if err == nil {
+				break
+			}
+
+			tooLarge := errors.Is(err, syscall.EMSGSIZE)
+			if !tooLarge {
+				_ = conn.Close()
+				conn = nil
+			}
+
+			if tooLarge || attempt >= syslogWriteAttempts {
+				_, _ = fmt.Fprintf(os.Stderr, "dropped log message which could not be sent to syslog server %s://%s: %s\n", s.network, s.address, err.Error())
+				break
+			}
+		}
+
+		if dropped := s.dropped.Swap(0); dropped > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "dropped %d log messages while syslog server %s://%s was unreachable\n", dropped, s.network, s.address)
+		}
+	}
+}
+
+// connect dials the syslog server until it accepts the connection. Consecutive dials are at least
+// syslogReconnectInterval apart.
+func (s *syslogBackend) connect() net.Conn {
+	reported := false
+	for {
+		if wait := syslogReconnectInterval - time.Since(s.lastDial); wait > 0 {
+			time.Sleep(wait)
+		}
+		s.lastDial = time.Now()
+
+		conn, err := net.DialTimeout(s.network, s.address, syslogDialTimeout)
+		if err == nil {
+			return conn
+		}
+
+		if !reported {
+			_, _ = fmt.Fprintf(os.Stderr, "could not connect to syslog server %s://%s, retrying every %s: %s\n", s.network, s.address, syslogReconnectInterval, err.Error())
+			reported = true
+		}
+	}
+}
+
+func (s *syslogBackend) format(level logging.Level, timestamp time.Time, message string) []byte {
+	priority := syslogFacilityLocal0*8 + syslogSeverity(level)
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, timestamp.Format(time.RFC3339Nano), s.hostname, s.tag, os.Getpid(), message)
+	msg = truncateMessage(msg, syslogMaxMessageSize)
+
+	if s.network == "tcp" || s.network == "unix" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	return []byte(msg)
+}
+
+// truncateMessage cuts msg to at most maxSize bytes without splitting a UTF-8 character.
+func truncateMessage(msg string, maxSize int) string {
+	if len(msg) <= maxSize {
+		return msg
+	}
+
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+
+	return msg[:cut]
+}
+
+func syslogSeverity(level logging.Level) int {
+	switch level {
+	case logging.CRITICAL:
+		return 2
+	case logging.ERROR:
+		return 3
+	case logging.WARNING:
+		return 4
+	case logging.NOTICE:
+		return 5
+	case logging.INFO:
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// LogFields are structured fields of a log record. Pass them as the last argument of a log call with a trailing " %v"
+// verb: text formats show them at the end of the message, the JSON format emits them as top-level keys.
+type LogFields map[string]string
+
+// String renders the fields sorted by key, e.g. "[path=/sonar principal=admin]".
+func (f LogFields) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", key, f[key]))
+	}
+
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// FindLogFields returns the fields contained in the arguments of a log call.
+func FindLogFields(args []interface{}) (LogFields, bool) {
+	for i := len(args) - 1; i >= 0; i-- {
+		if fields, ok := args[i].(LogFields); ok {
+			return fields, true
+		}
+	}
+
+	return nil, false
+}
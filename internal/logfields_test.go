@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFields_String(t *testing.T) {
+	fields := LogFields{"principal": "admin", "path": "/sonar"}
+
+	assert.Equal(t, "[path=/sonar principal=admin]", fields.String())
+}
+
+func TestFindLogFields(t *testing.T) {
+	t.Run("fields found", func(t *testing.T) {
+		fields, ok := FindLogFields([]interface{}{"a", 1, LogFields{"path": "/sonar"}})
+
+		assert.True(t, ok)
+		assert.Equal(t, LogFields{"path": "/sonar"}, fields)
+	})
+
+	t.Run("no fields", func(t *testing.T) {
+		_, ok := FindLogFields([]interface{}{"a", 1})
+
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,22 @@
+package internal
+
+import "context"
+
+type requestIDContextKey int
+
+const (
+	requestIDKey requestIDContextKey = iota
+)
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func GetRequestID(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	if !ok {
+		return "", false
+	}
+
+	return requestID, true
+}
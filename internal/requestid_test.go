@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRequestID(t *testing.T) {
+	t.Run("request id found in context", func(t *testing.T) {
+		ctx := WithRequestID(context.TODO(), "abc")
+
+		requestID, ok := GetRequestID(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "abc", requestID)
+	})
+
+	t.Run("no request id in context", func(t *testing.T) {
+		_, ok := GetRequestID(context.TODO())
+		assert.False(t, ok)
+	})
+}
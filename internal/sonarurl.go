@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// SonarApiURL returns the url of a SonarQube web api. Requests reach SonarQube at the host of serviceURL with the
+// path of the base url, so the api lives below the path of baseURL.
+func SonarApiURL(serviceURL string, baseURL string, apiPath string) (string, error) {
+	service, err := url.Parse(serviceURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse service url '%s': %w", serviceURL, err)
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse base url '%s': %w", baseURL, err)
+	}
+
+	apiURL := url.URL{Scheme: service.Scheme, Host: service.Host}
+	return apiURL.JoinPath(base.Path, apiPath).String(), nil
+}
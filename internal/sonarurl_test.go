@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSonarApiURL(t *testing.T) {
+	t.Run("use context path of base url", func(t *testing.T) {
+		apiURL, err := SonarApiURL("http://localhost:9000/", "https://ces.example.com/sonar/", "api/system/status")
+
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:9000/sonar/api/system/status", apiURL)
+	})
+
+	t.Run("ignore path of service url", func(t *testing.T) {
+		apiURL, err := SonarApiURL("http://sonar:9000/sonar/", "https://ces.example.com/sonar", "api/system/status")
+
+		require.NoError(t, err)
+		assert.Equal(t, "http://sonar:9000/sonar/api/system/status", apiURL)
+	})
+
+	t.Run("invalid service url", func(t *testing.T) {
+		_, err := SonarApiURL("http://[::1", "https://ces.example.com/sonar/", "api/system/status")
+
+		assert.ErrorContains(t, err, "service url")
+	})
+}
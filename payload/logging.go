@@ -0,0 +1,148 @@
+package payload
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/op/go-logging"
+)
+
+const (
+	sonarTimestampLayout = "2006.01.02 15:04:05"
+	// maxLineLength limits the length of forwarded output lines, the rest of a longer line is dropped.
+	maxLineLength = 64 * 1024
+)
+
+var log = logging.MustGetLogger(config.LogModulePayload)
+
+// sonarLogLinePattern matches SonarQube's default log layout, e.g.
+// "2025.01.01 12:00:00 INFO  web[][o.s.s.p.Platform] Web Server is operational"
+var sonarLogLinePattern = regexp.MustCompile(`^(\d{4}\.\d{2}\.\d{2} \d{2}:\d{2}:\d{2}) (TRACE|DEBUG|INFO|WARN|ERROR)\s+(\w+)\[([^]]*)]\[([^]]*)] ?(.*)$`)
+
+// LogEvent is a single, parsed SonarQube log line.
+type LogEvent struct {
+	Time    time.Time
+	Level   logging.Level
+	Process string
+	Logger  string
+	Message string
+}
+
+func (e LogEvent) String() string {
+	return fmt.Sprintf("%s[%s] %s", e.Process, e.Logger, e.Message)
+}
+
+// ParseLogLine parses a line in SonarQube's log layout. The second return value is false if the line does not match
+// the layout, e.g. for stack traces or JVM output.
+func ParseLogLine(line string) (LogEvent, bool) {
+	matches := sonarLogLinePattern.FindStringSubmatch(line)
+	if matches == nil {
+		return LogEvent{}, false
+	}
+
+	timestamp, err := time.ParseInLocation(sonarTimestampLayout, matches[1], time.Local)
+	if err != nil {
+		return LogEvent{}, false
+	}
+
+	return LogEvent{
+		Time:    timestamp,
+		Level:   convertSonarLogLevel(matches[2]),
+		Process: matches[3],
+		Logger:  matches[5],
+		Message: matches[6],
+	}, true
+}
+
+func convertSonarLogLevel(level string) logging.Level {
+	switch level {
+	case "ERROR":
+		return logging.ERROR
+	case "WARN":
+		return logging.WARNING
+	case "INFO":
+		return logging.INFO
+	default:
+		return logging.DEBUG
+	}
+}
+
+// ForwardOutput reads the payload output line by line and re-emits it through the carp log backend. Lines in
+// SonarQube's log layout keep their level and timestamp, all other lines (like stack traces) inherit the level of the
+// last parsed line so that they are filtered together with it. The output is read until it ends, overlong lines are
+// truncated, so that the payload never blocks on a full pipe.
+func ForwardOutput(reader io.Reader) error {
+	lines := bufio.NewReader(reader)
+
+	lastLevel := logging.INFO
+	for {
+		line, err := readLine(lines)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read payload output: %w", err)
+		}
+
+		event, ok := ParseLogLine(line)
+		if !ok {
+			emit(lastLevel, line)
+			continue
+		}
+
+		lastLevel = event.Level
+		emit(event.Level, config.TimedMessage{Time: event.Time, Message: event.String()})
+	}
+}
+
+// readLine returns the next line without line ending. Lines longer than maxLineLength are read completely but only
+// their beginning is returned.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	truncated := false
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if len(line) > 0 {
+				// a final line without line ending
+				return finishLine(line, truncated), nil
+			}
+			return "", err
+		}
+
+		if remaining := maxLineLength - len(line); len(fragment) > remaining {
+			fragment = fragment[:remaining]
+			truncated = true
+		}
+		line = append(line, fragment...)
+
+		if !isPrefix {
+			return finishLine(line, truncated), nil
+		}
+	}
+}
+
+func finishLine(line []byte, truncated bool) string {
+	if truncated {
+		return string(line) + " [truncated]"
+	}
+
+	return string(line)
+}
+
+func emit(level logging.Level, message any) {
+	switch level {
+	case logging.ERROR:
+		log.Errorf("%s", message)
+	case logging.WARNING:
+		log.Warningf("%s", message)
+	case logging.INFO:
+		log.Infof("%s", message)
+	default:
+		log.Debugf("%s", message)
+	}
+}
@@ -0,0 +1,98 @@
+package payload
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/mocks"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLine(t *testing.T) {
+	t.Run("web log line", func(t *testing.T) {
+		event, ok := ParseLogLine("2025.01.01 12:00:00 INFO  web[][o.s.s.p.Platform] Web Server is operational")
+
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local), event.Time)
+		assert.Equal(t, logging.INFO, event.Level)
+		assert.Equal(t, "web", event.Process)
+		assert.Equal(t, "o.s.s.p.Platform", event.Logger)
+		assert.Equal(t, "Web Server is operational", event.Message)
+	})
+
+	t.Run("compute engine log line with task uuid", func(t *testing.T) {
+		event, ok := ParseLogLine("2025.01.01 12:00:00 WARN  ce[AYx1][o.s.c.t.CeWorkerImpl] Execution failed")
+
+		require.True(t, ok)
+		assert.Equal(t, logging.WARNING, event.Level)
+		assert.Equal(t, "ce", event.Process)
+		assert.Equal(t, "o.s.c.t.CeWorkerImpl", event.Logger)
+	})
+
+	t.Run("map trace to debug", func(t *testing.T) {
+		event, ok := ParseLogLine("2025.01.01 12:00:00 TRACE es[][o.e.n.Node] starting")
+
+		require.True(t, ok)
+		assert.Equal(t, logging.DEBUG, event.Level)
+		assert.Equal(t, "es", event.Process)
+	})
+
+	t.Run("no sonar log line", func(t *testing.T) {
+		_, ok := ParseLogLine("\tat org.sonar.server.Platform.start(Platform.java:42)")
+
+		assert.False(t, ok)
+	})
+}
+
+func TestForwardOutput(t *testing.T) {
+	lm, reset := mocks.CreateLoggingMock(log)
+	defer reset()
+
+	output := strings.Join([]string{
+		"2025.01.01 12:00:00 INFO  web[][o.s.s.p.Platform] Web Server is operational",
+		"2025.01.01 12:00:01 ERROR web[][o.s.s.p.Platform] Background initialization failed",
+		"java.lang.IllegalStateException: boom",
+		"2025.01.01 12:00:02 DEBUG ce[][o.s.c.a.CeProcessLogging] done",
+	}, "\n")
+
+	err := ForwardOutput(strings.NewReader(output))
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, lm.InfoCalls)
+	assert.Equal(t, 2, lm.ErrorCalls)
+	assert.Equal(t, 1, lm.DebugCalls)
+}
+
+func TestForwardOutput_longLines(t *testing.T) {
+	lm, reset := mocks.CreateLoggingMock(log)
+	defer reset()
+
+	output := strings.Repeat("x", 3*1024*1024) + "\n2025.01.01 12:00:00 WARN  web[][o.s.s.p.Platform] after long line\nno line ending"
+
+	err := ForwardOutput(strings.NewReader(output))
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, lm.InfoCalls)
+	// the unparsed last line inherits the level of the warning
+	assert.Equal(t, 2, lm.WarningCalls)
+}
+
+func TestReadLine(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", maxLineLength+10)+"\nshort"), 16)
+
+	line, err := readLine(reader)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", maxLineLength)+" [truncated]", line)
+
+	line, err = readLine(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "short", line)
+
+	_, err = readLine(reader)
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,161 @@
+package payload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+const (
+	defaultPreStartTimeout       = time.Minute
+	defaultPreStartRetryInterval = 5 * time.Second
+	// commandWaitDelay is the time to wait for the output of a command to close after it exited or was killed.
+	commandWaitDelay = 5 * time.Second
+)
+
+// RunPreStartSteps executes the steps in order and stops at the first step that fails after all its retries.
+func RunPreStartSteps(ctx context.Context, steps []config.PreStartStep) error {
+	for i, step := range steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		log.Infof("Run pre-start step %s", name)
+		if err := runPreStartStep(ctx, step); err != nil {
+			return fmt.Errorf("pre-start step %s failed: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func runPreStartStep(ctx context.Context, step config.PreStartStep) error {
+	action, err := preStartAction(step)
+	if err != nil {
+		return err
+	}
+
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = defaultPreStartTimeout
+	}
+
+	retryInterval := step.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultPreStartRetryInterval
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = action(attemptCtx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= step.Retries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		log.Warningf("attempt %d/%d failed, retrying in %s: %s", attempt+1, step.Retries+1, retryInterval, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func preStartAction(step config.PreStartStep) (func(ctx context.Context) error, error) {
+	var actions []func(ctx context.Context) error
+
+	if len(step.Command) != 0 {
+		actions = append(actions, func(ctx context.Context) error { return runCommand(ctx, step.Command) })
+	}
+	if step.WaitTCP != "" {
+		actions = append(actions, func(ctx context.Context) error { return waitForTCP(ctx, step.WaitTCP) })
+	}
+	if step.WaitHTTP != "" {
+		actions = append(actions, func(ctx context.Context) error { return waitForHTTP(ctx, step.WaitHTTP) })
+	}
+
+	if len(actions) != 1 {
+		return nil, errors.New("exactly one of command, wait-tcp and wait-http must be set")
+	}
+
+	return actions[0], nil
+}
+
+func runCommand(ctx context.Context, command []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	// the command gets its own process group so that a timeout also kills the processes it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// processes which left the group could hold the output open forever
+	cmd.WaitDelay = commandWaitDelay
+
+	output, outputWriter := io.Pipe()
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		if err := ForwardOutput(output); err != nil {
+			log.Errorf("failed to pipe command output: %s", err.Error())
+		}
+	}()
+
+	err := cmd.Run()
+	_ = outputWriter.Close()
+	<-forwarded
+
+	if err != nil {
+		return fmt.Errorf("command '%s' failed: %w", strings.Join(command, " "), err)
+	}
+
+	return nil
+}
+
+func waitForTCP(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %w", address, err)
+	}
+
+	return conn.Close()
+}
+
+func waitForHTTP(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("could not create request for %s: %w", target, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package payload
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPreStartSteps(t *testing.T) {
+	t.Run("run all steps in order", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		var calls []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, r.URL.Path)
+		}))
+		defer server.Close()
+
+		err = RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Name: "postgres", WaitTCP: listener.Addr().String()},
+			{Name: "render", Command: config.StringList{"true"}},
+			{Name: "http", WaitHTTP: server.URL + "/ready"},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/ready"}, calls)
+	})
+
+	t.Run("retry failing step", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{WaitHTTP: server.URL, Retries: 2, RetryInterval: time.Millisecond},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("abort on failing step", func(t *testing.T) {
+		executed := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			executed = true
+		}))
+		defer server.Close()
+
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Name: "setup", Command: config.StringList{"false"}, Retries: 1, RetryInterval: time.Millisecond},
+			{WaitHTTP: server.URL},
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pre-start step setup failed: giving up after 2 attempts")
+		assert.False(t, executed)
+	})
+
+	t.Run("abort on command timeout", func(t *testing.T) {
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Command: config.StringList{"sleep", "10"}, Timeout: 10 * time.Millisecond},
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pre-start step #1 failed")
+	})
+
+	t.Run("kill processes started by a timed out command", func(t *testing.T) {
+		start := time.Now()
+
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Command: config.StringList{"sh", "-c", "sleep 10 & sleep 10"}, Timeout: 100 * time.Millisecond},
+		})
+
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), commandWaitDelay)
+	})
+
+	t.Run("pass quoted arguments", func(t *testing.T) {
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Command: config.StringList{"sh", "-c", "test \"$0\" = 'a b'", "a b"}},
+		})
+
+		require.NoError(t, err)
+	})
+
+	t.Run("fail on ambiguous step", func(t *testing.T) {
+		err := RunPreStartSteps(context.Background(), []config.PreStartStep{
+			{Command: config.StringList{"true"}, WaitTCP: "localhost:5432"},
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exactly one of command, wait-tcp and wait-http must be set")
+	})
+}
@@ -0,0 +1,160 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultStopTimeout = 30 * time.Second
+
+// Supervisor starts the payload application and restarts it on demand.
+type Supervisor struct {
+	command     string
+	stopTimeout time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+// NewSupervisor creates a supervisor for the given command line. The payload gets stopTimeout to shut down
+// gracefully before it is killed.
+func NewSupervisor(command string, stopTimeout time.Duration) *Supervisor {
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeout
+	}
+
+	return &Supervisor{
+		command:     command,
+		stopTimeout: stopTimeout,
+	}
+}
+
+// Start launches the payload in background and forwards its output to the carp logger.
+func (s *Supervisor) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.start()
+}
+
+func (s *Supervisor) start() error {
+	splitted := strings.Fields(s.command)
+	if len(splitted) == 0 {
+		return errors.New("payload command must not be empty, set application-exec-command or enable proxy-only")
+	}
+
+	log.Debugf("Execute command '%s'", s.command)
+	cmd := exec.Command(splitted[0], splitted[1:]...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdout pipeline: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stderr pipeline: %w", err)
+	}
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start payload: %w", err)
+	}
+
+	var output sync.WaitGroup
+	output.Add(2)
+
+	go func() {
+		defer output.Done()
+		if err := ForwardOutput(stdout); err != nil {
+			log.Errorf("failed to pipe stdout output: %s", err.Error())
+		}
+	}()
+
+	go func() {
+		defer output.Done()
+		if err := ForwardOutput(stderr); err != nil {
+			log.Errorf("failed to pipe stderr output: %s", err.Error())
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		// all output must be read before waiting, because Wait closes the pipes
+		output.Wait()
+		err := cmd.Wait()
+		if err != nil {
+			log.Warningf("payload process %d exited: %s", cmd.Process.Pid, err.Error())
+		} else {
+			log.Infof("payload process %d exited", cmd.Process.Pid)
+		}
+		close(exited)
+	}()
+
+	s.cmd = cmd
+	s.exited = exited
+	log.Infof("Started payload process %d", cmd.Process.Pid)
+
+	return nil
+}
+
+// Stop terminates the payload gracefully and kills it if it does not exit within the stop timeout.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stop()
+}
+
+func (s *Supervisor) stop() error {
+	if s.cmd == nil {
+		return nil
+	}
+
+	select {
+	case <-s.exited:
+		return nil
+	default:
+	}
+
+	log.Infof("Stopping payload process %d", s.cmd.Process.Pid)
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to terminate payload process: %w", err)
+	}
+
+	select {
+	case <-s.exited:
+		return nil
+	case <-time.After(s.stopTimeout):
+	}
+
+	log.Warningf("payload process %d did not stop within %s, killing it", s.cmd.Process.Pid, s.stopTimeout)
+	if err := s.cmd.Process.Kill(); err != nil {
+		return fmt.Errorf("failed to kill payload process: %w", err)
+	}
+
+	<-s.exited
+
+	return nil
+}
+
+// Restart stops the payload and starts it again.
+func (s *Supervisor) Restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.stop(); err != nil {
+		return fmt.Errorf("failed to stop payload for restart: %w", err)
+	}
+
+	if err := s.start(); err != nil {
+		return fmt.Errorf("failed to start payload after restart: %w", err)
+	}
+
+	return nil
+}
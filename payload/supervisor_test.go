@@ -0,0 +1,56 @@
+package payload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor_Start(t *testing.T) {
+	t.Run("start and stop payload", func(t *testing.T) {
+		supervisor := NewSupervisor("sleep 60", time.Second)
+
+		require.NoError(t, supervisor.Start())
+		firstPid := supervisor.cmd.Process.Pid
+
+		require.NoError(t, supervisor.Stop())
+
+		select {
+		case <-supervisor.exited:
+		default:
+			t.Fatal("payload should have exited")
+		}
+		assert.NotZero(t, firstPid)
+	})
+
+	t.Run("fail on empty command", func(t *testing.T) {
+		supervisor := NewSupervisor("", time.Second)
+
+		err := supervisor.Start()
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must not be empty")
+	})
+
+	t.Run("fail on unknown command", func(t *testing.T) {
+		supervisor := NewSupervisor("/does/not/exist", time.Second)
+
+		err := supervisor.Start()
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to start payload")
+	})
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	supervisor := NewSupervisor("sleep 60", time.Second)
+	require.NoError(t, supervisor.Start())
+	firstPid := supervisor.cmd.Process.Pid
+
+	require.NoError(t, supervisor.Restart())
+	defer func() { _ = supervisor.Stop() }()
+
+	assert.NotEqual(t, firstPid, supervisor.cmd.Process.Pid)
+}
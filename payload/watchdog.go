@@ -0,0 +1,161 @@
+package payload
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const (
+	defaultWatchdogInterval         = 30 * time.Second
+	defaultWatchdogFailureThreshold = 5
+	defaultWatchdogProbeTimeout     = 10 * time.Second
+	defaultWatchdogGracePeriod      = 5 * time.Minute
+	sonarStatusApiPath              = "api/system/status"
+)
+
+var (
+	restartsTotal      = expvar.NewInt("payload_restarts_total")
+	probeFailuresTotal = expvar.NewInt("payload_probe_failures_total")
+	healthy            = expvar.NewInt("payload_healthy")
+)
+
+// Restarter restarts the payload application.
+type Restarter interface {
+	Restart() error
+}
+
+// WatchdogOptions configure how often and how tolerant the watchdog probes the payload.
+type WatchdogOptions struct {
+	Interval         time.Duration
+	FailureThreshold int
+	ProbeTimeout     time.Duration
+	// GracePeriod is the time after a (re-)start in which failing probes are ignored, because SonarQube does not
+	// answer while its search server is starting.
+	GracePeriod time.Duration
+	// Transport sends the probes to SonarQube. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// Watchdog probes SonarQube's web server and restarts the payload if it stopped answering.
+type Watchdog struct {
+	probeURL  string
+	client    *http.Client
+	options   WatchdogOptions
+	payload   Restarter
+	failures  int
+	graceTime time.Time
+	now       func() time.Time
+}
+
+// NewWatchdog creates a watchdog probing the status endpoint of SonarQube at serviceURL below the context path of
+// baseURL. If payload is nil, SonarQube runs outside of carp and the watchdog only reports its health.
+func NewWatchdog(serviceURL string, baseURL string, payload Restarter, options WatchdogOptions) (*Watchdog, error) {
+	probeURL, err := internal.SonarApiURL(serviceURL, baseURL, sonarStatusApiPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create probe url: %w", err)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = defaultWatchdogInterval
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = defaultWatchdogFailureThreshold
+	}
+	if options.ProbeTimeout <= 0 {
+		options.ProbeTimeout = defaultWatchdogProbeTimeout
+	}
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = defaultWatchdogGracePeriod
+	}
+
+	return &Watchdog{
+		probeURL: probeURL,
+		client:   &http.Client{Transport: options.Transport, Timeout: options.ProbeTimeout},
+		options:  options,
+		payload:  payload,
+		now:      time.Now,
+	}, nil
+}
+
+// Run probes the payload until the context is cancelled.
+func (w *Watchdog) Run(ctx context.Context) {
+	log.Infof("Start payload watchdog probing %s every %s", w.probeURL, w.options.Interval)
+	w.graceTime = w.now().Add(w.options.GracePeriod)
+
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+func (w *Watchdog) check(ctx context.Context) {
+	if w.now().Before(w.graceTime) {
+		return
+	}
+
+	err := w.probe(ctx)
+	if err == nil {
+		if w.failures > 0 {
+			log.Infof("payload answers again after %d failed probes", w.failures)
+		}
+		w.failures = 0
+		healthy.Set(1)
+		return
+	}
+
+	w.failures++
+	probeFailuresTotal.Add(1)
+	log.Warningf("payload probe %d/%d failed: %s", w.failures, w.options.FailureThreshold, err.Error())
+
+	if w.failures < w.options.FailureThreshold {
+		return
+	}
+
+	healthy.Set(0)
+	if w.payload == nil {
+		log.Errorf("SonarQube at %s did not answer %d consecutive probes", w.probeURL, w.failures)
+		w.failures = 0
+		return
+	}
+
+	log.Errorf("payload did not answer %d consecutive probes, restarting it", w.failures)
+	restartsTotal.Add(1)
+	if err = w.payload.Restart(); err != nil {
+		log.Errorf("failed to restart payload: %s", err.Error())
+	}
+
+	w.failures = 0
+	w.graceTime = w.now().Add(w.options.GracePeriod)
+}
+
+// probe succeeds as long as the web server answers, regardless of the SonarQube status.
+func (w *Watchdog) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("could not create probe request: %w", err)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %w", w.probeURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, w.probeURL)
+	}
+
+	return nil
+}
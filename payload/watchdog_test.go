@@ -0,0 +1,115 @@
+package payload
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type restarterStub struct {
+	restarts int
+}
+
+func (r *restarterStub) Restart() error {
+	r.restarts++
+	return nil
+}
+
+func TestWatchdog_check(t *testing.T) {
+	t.Run("restart payload after consecutive failed probes", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer sonar.Close()
+
+		payload := &restarterStub{}
+		watchdog, err := NewWatchdog(sonar.URL, "https://ces.example.com/sonar/", payload, WatchdogOptions{FailureThreshold: 3})
+		require.NoError(t, err)
+		restartsBefore := restartsTotal.Value()
+
+		for i := 0; i < 3; i++ {
+			watchdog.check(context.Background())
+		}
+
+		assert.Equal(t, 1, payload.restarts)
+		assert.Equal(t, 0, watchdog.failures)
+		assert.Equal(t, restartsBefore+1, restartsTotal.Value())
+		assert.True(t, watchdog.graceTime.After(time.Now()))
+	})
+
+	t.Run("reset failures if payload answers again", func(t *testing.T) {
+		healthy := false
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/sonar/api/system/status", r.URL.Path)
+			if !healthy {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"STARTING"}`))
+		}))
+		defer sonar.Close()
+
+		payload := &restarterStub{}
+		watchdog, err := NewWatchdog(sonar.URL, "https://ces.example.com/sonar/", payload, WatchdogOptions{FailureThreshold: 3})
+		require.NoError(t, err)
+
+		watchdog.check(context.Background())
+		watchdog.check(context.Background())
+		healthy = true
+		watchdog.check(context.Background())
+
+		assert.Equal(t, 0, payload.restarts)
+		assert.Equal(t, 0, watchdog.failures)
+	})
+
+	t.Run("only report unhealthy remote sonarqube in proxy-only mode", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer sonar.Close()
+
+		watchdog, err := NewWatchdog(sonar.URL, "https://ces.example.com/sonar/", nil, WatchdogOptions{FailureThreshold: 2})
+		require.NoError(t, err)
+		restartsBefore := restartsTotal.Value()
+
+		watchdog.check(context.Background())
+		watchdog.check(context.Background())
+
+		assert.Equal(t, restartsBefore, restartsTotal.Value())
+		assert.Equal(t, int64(0), healthy.Value())
+		assert.Equal(t, 0, watchdog.failures)
+	})
+
+	t.Run("probe with configured transport", func(t *testing.T) {
+		sonar := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"status":"UP"}`))
+		}))
+		defer sonar.Close()
+
+		payload := &restarterStub{}
+		watchdog, err := NewWatchdog(sonar.URL, "https://ces.example.com/sonar/", payload, WatchdogOptions{FailureThreshold: 1, Transport: sonar.Client().Transport})
+		require.NoError(t, err)
+
+		watchdog.check(context.Background())
+
+		assert.Equal(t, 0, payload.restarts)
+		assert.Equal(t, int64(1), healthy.Value())
+	})
+
+	t.Run("ignore probes during grace period", func(t *testing.T) {
+		payload := &restarterStub{}
+		watchdog, err := NewWatchdog("http://localhost:0", "https://ces.example.com/sonar/", payload, WatchdogOptions{FailureThreshold: 1})
+		require.NoError(t, err)
+		watchdog.graceTime = time.Now().Add(time.Hour)
+
+		watchdog.check(context.Background())
+
+		assert.Equal(t, 0, payload.restarts)
+		assert.Equal(t, 0, watchdog.failures)
+	})
+}
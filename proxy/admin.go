@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cloudogu/go-cas"
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+// carpPath returns the path below the carp base url under which carp offers its own endpoints.
+func carpPath(baseURL string, suffix string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse base url '%s': %w", baseURL, err)
+	}
+
+	return path.Join("/", u.Path, suffix), nil
+}
+
+// isSameOrigin reports whether a request was sent from a page of origin. Browsers send the Origin header with every
+// POST request, the Referer is only checked for clients which omit it.
+func isSameOrigin(req *http.Request, origin *url.URL) bool {
+	source := req.Header.Get("Origin")
+	if source == "" {
+		source = req.Header.Get("Referer")
+	}
+
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(sourceURL.Scheme, origin.Scheme) && strings.EqualFold(sourceURL.Host, origin.Host)
+}
+
+func casUser(r *http.Request) (internal.User, bool) {
+	if !cas.IsAuthenticated(r) {
+		return internal.User{}, false
+	}
+
+	return internal.User{
+		UserName:   cas.Username(r),
+		Attributes: internal.UserAttributes(cas.Attributes(r)),
+	}, true
+}
+
+func isMemberOf(user internal.User, group string) bool {
+	return group != "" && slices.Contains(user.GetGroups(), group)
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		log.Errorf("failed to write json response: %s", err.Error())
+	}
+}
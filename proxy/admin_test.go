@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCarpPath(t *testing.T) {
+	migrationPath, err := carpPath("http://localhost:8080/sonar/", carpMigrationPathSuffix)
+
+	require.NoError(t, err)
+	assert.Equal(t, "/sonar/carp/db-migration", migrationPath)
+}
+
+func TestIsMemberOf(t *testing.T) {
+	user := internal.User{Attributes: internal.UserAttributes{"groups": {"cesAdmin", "developers"}}}
+
+	assert.True(t, isMemberOf(user, "cesAdmin"))
+	assert.False(t, isMemberOf(user, "admins"))
+	assert.False(t, isMemberOf(user, ""))
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// anonymousMiddleware passes requests of the anonymous paths to serveAnonymous before they reach CAS.
+func anonymousMiddleware(anonymous pathPatterns, serveAnonymous http.HandlerFunc) middleware {
+	return func(next http.Handler) http.Handler {
+		if len(anonymous) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			if anonymous.matches(req) {
+				serveAnonymous(writer, req)
+				return
+			}
+
+			next.ServeHTTP(writer, req)
+		})
+	}
+}
+
+// serveAnonymous forwards a request without authentication. The identity headers are removed so that a client cannot
+// impersonate a user on anonymous paths.
+func (p proxyHandler) serveAnonymous(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("forward anonymous request to %s %v", r.URL, requestLogFields(r))
+
+	for _, header := range []string{p.headers.Principal, p.headers.Role, p.headers.Mail, p.headers.Name} {
+		if header != "" {
+			r.Header.Del(header)
+		}
+	}
+
+	p.forward(w, r)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAnonymousPaths = pathPatterns{
+	{Path: "/sonar/api/system/status", Methods: []string{"GET"}},
+	{Path: "/sonar/api/project_badges/*"},
+	{Path: "/sonar/api/alm_integrations/webhook", Methods: []string{"post"}},
+	{Path: "/sonar/js/**"},
+}
+
+func TestAnonymousMiddleware(t *testing.T) {
+	targetURL, err := url.Parse("http://sonar:9000")
+	require.NoError(t, err)
+	var forwarded *http.Request
+	pHandler := proxyHandler{
+		targetURL: targetURL,
+		forwarder: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r
+			w.WriteHeader(http.StatusOK)
+		}),
+		headers: authorizationHeaders{Principal: "X-Forwarded-Login", Role: "X-Forwarded-Groups", Mail: "X-Forwarded-Email", Name: "X-Forwarded-Name"},
+	}
+	casHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+	handler := anonymousMiddleware(testAnonymousPaths, pHandler.serveAnonymous)(casHandler)
+
+	t.Run("forward anonymous path without identity headers", func(t *testing.T) {
+		forwarded = nil
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/sonar/api/system/status", nil)
+		req.Header.Set("X-Forwarded-Login", "admin")
+		req.Header.Set("X-Forwarded-Groups", "sonar-administrators")
+		req.Header.Set("X-Forwarded-Email", "admin@example.com")
+		req.Header.Set("X-Forwarded-Name", "Admin")
+
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		require.NotNil(t, forwarded)
+		assert.Equal(t, "sonar:9000", forwarded.URL.Host)
+		assert.Empty(t, forwarded.Header.Values("X-Forwarded-Login"))
+		assert.Empty(t, forwarded.Header.Values("X-Forwarded-Groups"))
+		assert.Empty(t, forwarded.Header.Values("X-Forwarded-Email"))
+		assert.Empty(t, forwarded.Header.Values("X-Forwarded-Name"))
+	})
+
+	t.Run("authenticate other paths with CAS", func(t *testing.T) {
+		forwarded = nil
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Nil(t, forwarded)
+	})
+
+	t.Run("forward request marked as anonymous by gateway mode", func(t *testing.T) {
+		forwarded = nil
+		req := httptest.NewRequest(http.MethodGet, "/sonar/projects", nil)
+		req.Header.Set("X-Forwarded-Login", "admin")
+
+		pHandler.ServeHTTP(httptest.NewRecorder(), withAnonymous(req))
+
+		require.NotNil(t, forwarded)
+		assert.Empty(t, forwarded.Header.Values("X-Forwarded-Login"))
+	})
+
+	t.Run("skip without anonymous paths", func(t *testing.T) {
+		next := anonymousMiddleware(nil, pHandler.serveAnonymous)(casHandler)
+		recorder := httptest.NewRecorder()
+
+		next.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/api/system/status", nil))
+
+		assert.Equal(t, http.StatusFound, recorder.Code)
+	})
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiRequests decides which requests are issued by programs. It is replaced by NewServer with the configured paths.
+var apiRequests = newAPIRequestMatcher(nil)
+
+type apiRequestMatcher struct {
+	pathPrefixes []string
+}
+
+func newAPIRequestMatcher(pathPrefixes []string) apiRequestMatcher {
+	return apiRequestMatcher{pathPrefixes: pathPrefixes}
+}
+
+func (m apiRequestMatcher) matches(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.Contains(r.URL.Path, "/api/") {
+		return true
+	}
+
+	for _, prefix := range m.pathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAPIRequest reports whether the request is issued by a program rather than by a user navigating with a browser.
+func isAPIRequest(r *http.Request) bool {
+	return apiRequests.matches(r)
+}
+
+// unauthenticatedAPIMiddleware answers unauthenticated API and XHR requests with 401 instead of a redirect to the CAS
+// login page, whose HTML the SonarQube frontend cannot handle. The response contains the login url so that the
+// frontend can reload.
+func unauthenticatedAPIMiddleware(loginURL func() string, isAuthenticated func(r *http.Request) bool) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			if isAuthenticated(req) || isAnonymousRequest(req) || req.URL.Path == sonarLogoutApiPath || !isAPIRequest(req) {
+				next.ServeHTTP(writer, req)
+				return
+			}
+
+			login := loginURL()
+			casLog.Debugf("answer unauthenticated API request with 401 %v", requestLogFields(req))
+
+			writer.Header().Set("WWW-Authenticate", `CAS login-url="`+login+`"`)
+			writeJSON(writer, http.StatusUnauthorized, map[string]any{
+				"status":    http.StatusUnauthorized,
+				"error":     "unauthenticated",
+				"message":   "The session is not authenticated, log in at loginUrl",
+				"loginUrl":  login,
+				"requestId": requestID(req),
+			})
+		})
+	}
+}
+
+// casLoginURL returns the login url of the current CAS which leads back to the SonarQube base url.
+func casLoginURL(endpoints *casEndpoints, baseURL string) func() string {
+	serviceLoginURL := casServiceLoginURL(endpoints)
+	return func() string {
+		loginURL, err := serviceLoginURL(baseURL)
+		if err != nil {
+			return ""
+		}
+
+		return loginURL
+	}
+}
+
+// casServiceLoginURL returns the login url of the current CAS which leads back to service.
+func casServiceLoginURL(endpoints *casEndpoints) func(service string) (string, error) {
+	return func(service string) (string, error) {
+		loginURL, err := endpoints.Login()
+		if err != nil {
+			return "", err
+		}
+
+		query := url.Values{"service": {service}}
+		loginURL.RawQuery = query.Encode()
+
+		return loginURL.String(), nil
+	}
+}
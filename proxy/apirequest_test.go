@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIRequestMatcher(t *testing.T) {
+	matcher := newAPIRequestMatcher([]string{"/sonar/batch/"})
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   bool
+	}{
+		{"browser navigation", "/sonar/projects", http.Header{"Accept": {"text/html,application/xhtml+xml,*/*;q=0.8"}}, false},
+		{"api path", "/sonar/api/issues/search", nil, true},
+		{"json accept header", "/sonar/projects", http.Header{"Accept": {"application/json"}}, true},
+		{"xhr", "/sonar/projects", http.Header{"X-Requested-With": {"XMLHttpRequest"}}, true},
+		{"configured path", "/sonar/batch/index", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+
+			assert.Equal(t, tt.want, matcher.matches(req))
+		})
+	}
+}
+
+func TestUnauthenticatedAPIMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+	login := "https://ces.example.com/cas/login?service=https%3A%2F%2Fces.example.com%2Fsonar%2F"
+	loginURL := func() string { return login }
+
+	t.Run("answer unauthenticated API request with 401", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		notAuthenticated := func(*http.Request) bool { return false }
+
+		unauthenticatedAPIMiddleware(loginURL, notAuthenticated)(next).ServeHTTP(recorder, newErrorRequest("/sonar/api/issues/search", ""))
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, `CAS login-url="`+loginURL()+`"`, recorder.Header().Get("WWW-Authenticate"))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "unauthenticated", body["error"])
+		assert.Equal(t, loginURL(), body["loginUrl"])
+		assert.Equal(t, "req-42", body["requestId"])
+	})
+
+	tests := []struct {
+		name          string
+		path          string
+		authenticated bool
+	}{
+		{"redirect browser navigation", "/sonar/projects", false},
+		{"forward logout api", sonarLogoutApiPath, false},
+		{"pass authenticated API request", "/sonar/api/issues/search", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			isAuthenticated := func(*http.Request) bool { return tt.authenticated }
+
+			unauthenticatedAPIMiddleware(loginURL, isAuthenticated)(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, http.StatusFound, recorder.Code)
+		})
+	}
+}
+
+func TestCasLoginURL(t *testing.T) {
+	endpoints, err := newCasEndpoints([]string{"https://ces.example.com/cas"}, 0)
+	require.NoError(t, err)
+
+	loginURL := casLoginURL(endpoints, "https://ces.example.com/sonar/")()
+
+	assert.Equal(t, "https://ces.example.com/cas/login?service=https%3A%2F%2Fces.example.com%2Fsonar%2F", loginURL)
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/cloudogu/go-cas"
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/op/go-logging"
+	"github.com/vulcand/oxy/v2/forward"
+)
+
+var auditLog = logging.MustGetLogger(config.LogModuleAudit)
+
+// trustedProxies are the reverse proxies in front of carp whose X-Forwarded-For entries are trusted. It is replaced by
+// NewServer with the configured proxies.
+var trustedProxies proxyNetworks
+
+const (
+	auditEventLogin            = "login"
+	auditEventLogout           = "logout"
+	auditEventSingleLogout     = "single-logout"
+	auditEventAccessDenied     = "access-denied"
+	auditEventAdminAction      = "admin-action"
+	auditEventReauthentication = "reauthentication"
+	auditOutcomeSuccess        = "success"
+	auditOutcomeFailure        = "failure"
+	auditTimestampLayout       = time.RFC3339Nano
+	unknownAuditSourceValue    = "-"
+)
+
+// auditRecord is a single entry of the audit log.
+type auditRecord struct {
+	Time      string   `json:"time"`
+	Event     string   `json:"event"`
+	Outcome   string   `json:"outcome"`
+	Principal string   `json:"principal,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	SourceIP  string   `json:"sourceIp"`
+	UserAgent string   `json:"userAgent"`
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	Detail    string   `json:"detail,omitempty"`
+	RequestID string   `json:"requestId,omitempty"`
+}
+
+// audit writes an audit record for the request. The principal is taken from the CAS authentication if present.
+func audit(r *http.Request, event string, outcome string, detail string) {
+	record := auditRecord{
+		Time:      time.Now().Format(auditTimestampLayout),
+		Event:     event,
+		Outcome:   outcome,
+		SourceIP:  sourceIP(r),
+		UserAgent: r.UserAgent(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Detail:    detail,
+		RequestID: requestID(r),
+	}
+
+	if user, ok := casUser(r); ok {
+		record.Principal = user.UserName
+		record.Groups = user.GetGroups()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("failed to marshal audit record: %s", err.Error())
+		return
+	}
+
+	auditLog.Infof("%s", data)
+}
+
+// proxyNetworks contains the addresses of trusted reverse proxies.
+type proxyNetworks []netip.Prefix
+
+// newProxyNetworks parses networks in CIDR notation or single IP addresses.
+func newProxyNetworks(networks []string) (proxyNetworks, error) {
+	var prefixes proxyNetworks
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			addr, err := netip.ParseAddr(network)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s': %w", network, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network '%s': %w", network, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func (n proxyNetworks) contains(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+
+	for _, prefix := range n {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceIP returns the client address. Clients can send any X-Forwarded-For header, so its entries are only followed
+// from the right as long as they were added by trusted proxies.
+func sourceIP(r *http.Request) string {
+	source := remoteHost(r)
+	if !trustedProxies.contains(source) {
+		return source
+	}
+
+	forwardedFor := strings.Split(strings.Join(r.Header.Values(forward.XForwardedFor), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(forwardedFor[i])
+		if entry == "" {
+			continue
+		}
+
+		source = entry
+		if !trustedProxies.contains(entry) {
+			break
+		}
+	}
+
+	return source
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		if r.RemoteAddr == "" {
+			return unknownAuditSourceValue
+		}
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// auditAuthenticationMiddleware audits the CAS authentication right behind the CAS handler, before other middlewares
+// may answer the request themselves.
+func auditAuthenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		auditAuthentication(req)
+		next.ServeHTTP(writer, req)
+	})
+}
+
+// auditAuthentication records logins and failed ticket validations of the request.
+func auditAuthentication(r *http.Request) {
+	if cas.IsFirstAuthenticatedRequest(r) {
+		audit(r, auditEventLogin, auditOutcomeSuccess, "")
+		return
+	}
+
+	if !cas.IsAuthenticated(r) && r.URL.Query().Get("ticket") != "" {
+		audit(r, auditEventLogin, auditOutcomeFailure, "service ticket validation failed")
+	}
+}
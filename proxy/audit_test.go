@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureAuditLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	backend := logging.NewBackendFormatter(logging.NewLogBackend(&buf, "", 0), logging.MustStringFormatter("%{message}"))
+	logging.SetBackend(backend).SetLevel(logging.INFO, "")
+
+	return &buf
+}
+
+func TestAudit(t *testing.T) {
+	buf := captureAuditLog(t)
+	req := httptest.NewRequest(http.MethodPost, "/sonar/carp/log-level", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.RemoteAddr = "10.0.0.1:51234"
+
+	audit(req, auditEventAccessDenied, auditOutcomeFailure, "log level api requires admin group")
+
+	var record auditRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, auditEventAccessDenied, record.Event)
+	assert.Equal(t, auditOutcomeFailure, record.Outcome)
+	assert.Equal(t, "10.0.0.1", record.SourceIP)
+	assert.Equal(t, "curl/8.0", record.UserAgent)
+	assert.Equal(t, "/sonar/carp/log-level", record.Path)
+	assert.Equal(t, "log level api requires admin group", record.Detail)
+	assert.NotEmpty(t, record.Time)
+}
+
+func TestAuditAuthentication(t *testing.T) {
+	t.Run("failed ticket validation", func(t *testing.T) {
+		buf := captureAuditLog(t)
+
+		auditAuthentication(httptest.NewRequest(http.MethodGet, "/sonar/?ticket=ST-1", nil))
+
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, auditEventLogin, record.Event)
+		assert.Equal(t, auditOutcomeFailure, record.Outcome)
+	})
+
+	t.Run("no record for unauthenticated request without ticket", func(t *testing.T) {
+		buf := captureAuditLog(t)
+
+		auditAuthentication(httptest.NewRequest(http.MethodGet, "/sonar/", nil))
+
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestAuditAuthenticationMiddleware(t *testing.T) {
+	buf := captureAuditLog(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// like middlewares which answer the request themselves
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	auditAuthenticationMiddleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/api/issues/search?ticket=ST-1", nil))
+
+	var record auditRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, auditEventLogin, record.Event)
+	assert.Equal(t, auditOutcomeFailure, record.Outcome)
+}
+
+func TestSourceIP(t *testing.T) {
+	proxies, err := newProxyNetworks([]string{"172.17.0.0/16", "10.1.1.1"})
+	require.NoError(t, err)
+	trustedProxies = proxies
+	defer func() { trustedProxies = nil }()
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		expectedSource string
+	}{
+		{name: "remote address of direct client", remoteAddr: "192.168.1.5:51234", forwardedFor: []string{"1.2.3.4"}, expectedSource: "192.168.1.5"},
+		{name: "client behind trusted proxy", remoteAddr: "172.17.0.1:51234", forwardedFor: []string{"192.168.1.5"}, expectedSource: "192.168.1.5"},
+		{name: "ignore forged entries", remoteAddr: "172.17.0.1:51234", forwardedFor: []string{"1.2.3.4, 192.168.1.5"}, expectedSource: "192.168.1.5"},
+		{name: "skip chained trusted proxies", remoteAddr: "172.17.0.1:51234", forwardedFor: []string{"1.2.3.4, 192.168.1.5", "10.1.1.1"}, expectedSource: "192.168.1.5"},
+		{name: "trusted proxy without header", remoteAddr: "172.17.0.1:51234", expectedSource: "172.17.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sonar/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, tt.expectedSource, sourceIP(req))
+		})
+	}
+}
+
+func TestNewProxyNetworks(t *testing.T) {
+	_, err := newProxyNetworks([]string{"172.17.0.0/33"})
+	assert.ErrorContains(t, err, "172.17.0.0/33")
+
+	_, err = newProxyNetworks([]string{"proxy"})
+	assert.ErrorContains(t, err, "proxy")
+}
@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudogu/go-cas"
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const (
+	defaultCasTimeout          = 10 * time.Second
+	defaultCasRetryInterval    = 200 * time.Millisecond
+	defaultCasFailoverCooldown = 30 * time.Second
+)
+
+var (
+	casRequestsTotal        = expvar.NewInt("cas_validation_requests_total")
+	casRequestFailuresTotal = expvar.NewInt("cas_validation_failures_total")
+	casRequestRetriesTotal  = expvar.NewInt("cas_validation_retries_total")
+	casRequestDurationMs    = expvar.NewInt("cas_validation_duration_ms_total")
+	casFailoversTotal       = expvar.NewInt("cas_failovers_total")
+)
+
+// casValidations links CAS requests to the requests whose tickets they validate.
+var casValidations validationRequests
+
+// validationRequests maps service tickets to the log fields of the requests which carry them. go-cas validates
+// tickets without the context of the incoming request, so the ticket is the only link between both requests.
+type validationRequests struct {
+	fields sync.Map
+}
+
+// Middleware registers the ticket of the request while the CAS handler validates it.
+func (v *validationRequests) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		ticket := req.URL.Query().Get("ticket")
+		if ticket == "" {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		v.fields.Store(ticket, requestLogFields(req))
+		defer v.fields.Delete(ticket)
+
+		next.ServeHTTP(writer, req)
+	})
+}
+
+// logFields returns the log fields of the request whose ticket the CAS request validates.
+func (v *validationRequests) logFields(casReq *http.Request) internal.LogFields {
+	if fields, ok := v.fields.Load(casReq.URL.Query().Get("ticket")); ok {
+		return fields.(internal.LogFields)
+	}
+
+	return internal.LogFields{}
+}
+
+// casEndpoints tracks the health of the configured CAS URLs. It implements cas.URLScheme so that redirects and
+// ticket validations use the first healthy CAS. A CAS whose request failed is skipped until its cooldown expired.
+type casEndpoints struct {
+	urls     []*url.URL
+	schemes  []cas.URLScheme
+	cooldown time.Duration
+
+	mu             sync.Mutex
+	unhealthyUntil []time.Time
+	now            func() time.Time
+}
+
+func newCasEndpoints(rawURLs []string, cooldown time.Duration) (*casEndpoints, error) {
+	if len(rawURLs) == 0 {
+		// an unset cas-url results in relative CAS urls as before
+		rawURLs = []string{""}
+	}
+
+	endpoints := &casEndpoints{
+		cooldown:       durationOrDefault(cooldown, defaultCasFailoverCooldown),
+		unhealthyUntil: make([]time.Time, len(rawURLs)),
+		now:            time.Now,
+	}
+
+	for _, rawURL := range rawURLs {
+		casUrl, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cas url: %s: %w", rawURL, err)
+		}
+
+		urlScheme := cas.NewDefaultURLScheme(casUrl)
+		urlScheme.ServiceValidatePath = path.Join("p3", "serviceValidate")
+
+		endpoints.urls = append(endpoints.urls, casUrl)
+		endpoints.schemes = append(endpoints.schemes, urlScheme)
+	}
+
+	return endpoints, nil
+}
+
+// current returns the index of the first healthy CAS. If all are unhealthy, the one which recovers first is used.
+func (e *casEndpoints) current() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	next := 0
+	for i, until := range e.unhealthyUntil {
+		if !now.Before(until) {
+			return i
+		}
+		if until.Before(e.unhealthyUntil[next]) {
+			next = i
+		}
+	}
+
+	return next
+}
+
+// Available reports whether at least one CAS is healthy.
+func (e *casEndpoints) Available() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, until := range e.unhealthyUntil {
+		if !now.Before(until) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *casEndpoints) markFailed(index int, fields internal.LogFields) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	wasHealthy := !e.now().Before(e.unhealthyUntil[index])
+	e.unhealthyUntil[index] = e.now().Add(e.cooldown)
+
+	if wasHealthy && len(e.urls) > 1 {
+		casFailoversTotal.Add(1)
+		casLog.Warningf("CAS %s is unhealthy, fail over to the next CAS for %s %v", e.urls[index], e.cooldown, fields)
+	}
+}
+
+func (e *casEndpoints) markHealthy(index int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.unhealthyUntil[index] = time.Time{}
+}
+
+// rewrite moves a request which was built for one CAS to the CAS with the given index.
+func (e *casEndpoints) rewrite(req *http.Request, index int) *http.Request {
+	target := e.urls[index]
+	for _, source := range e.urls {
+		if req.URL.Scheme != source.Scheme || req.URL.Host != source.Host || !strings.HasPrefix(req.URL.Path, source.Path) {
+			continue
+		}
+
+		rewritten := req.Clone(req.Context())
+		rewritten.URL.Scheme = target.Scheme
+		rewritten.URL.Host = target.Host
+		rewritten.URL.Path = target.Path + strings.TrimPrefix(req.URL.Path, source.Path)
+		rewritten.Host = ""
+
+		return rewritten
+	}
+
+	return req
+}
+
+func (e *casEndpoints) Login() (*url.URL, error) {
+	return e.schemes[e.current()].Login()
+}
+
+func (e *casEndpoints) Logout() (*url.URL, error) {
+	return e.schemes[e.current()].Logout()
+}
+
+func (e *casEndpoints) Validate() (*url.URL, error) {
+	return e.schemes[e.current()].Validate()
+}
+
+func (e *casEndpoints) ServiceValidate() (*url.URL, error) {
+	return e.schemes[e.current()].ServiceValidate()
+}
+
+func (e *casEndpoints) RestGrantingTicket() (*url.URL, error) {
+	return e.schemes[e.current()].RestGrantingTicket()
+}
+
+func (e *casEndpoints) RestServiceTicket(tgt string) (*url.URL, error) {
+	return e.schemes[e.current()].RestServiceTicket(tgt)
+}
+
+func (e *casEndpoints) RestLogout(tgt string) (*url.URL, error) {
+	return e.schemes[e.current()].RestLogout(tgt)
+}
+
+// casRetryTransport limits the duration of each request to CAS and retries requests which did not reach CAS with
+// exponential backoff and jitter. Every attempt is sent to the currently healthiest CAS.
+type casRetryTransport struct {
+	next          http.RoundTripper
+	endpoints     *casEndpoints
+	timeout       time.Duration
+	retries       int
+	retryInterval time.Duration
+}
+
+func newCasRetryTransport(next http.RoundTripper, endpoints *casEndpoints, configuration config.Configuration) *casRetryTransport {
+	return &casRetryTransport{
+		next:          next,
+		endpoints:     endpoints,
+		timeout:       durationOrDefault(configuration.CasTimeout, defaultCasTimeout),
+		retries:       max(configuration.CasRetries, 0),
+		retryInterval: durationOrDefault(configuration.CasRetryInterval, defaultCasRetryInterval),
+	}
+}
+
+func (t *casRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	casRequestsTotal.Add(1)
+	fields := casValidations.logFields(req)
+
+	resp, err := t.roundTripWithRetries(req, fields)
+
+	duration := time.Since(start)
+	casRequestDurationMs.Add(duration.Milliseconds())
+	if err != nil {
+		casRequestFailuresTotal.Add(1)
+		casLog.Errorf("CAS request to %s failed after %s: %s %v", req.URL.Path, duration, err.Error(), fields)
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		casRequestFailuresTotal.Add(1)
+		casLog.Errorf("CAS request to %s failed with status %d after %s %v", req.URL.Path, resp.StatusCode, duration, fields)
+		return resp, nil
+	}
+
+	casLog.Debugf("CAS request to %s answered with status %d after %s %v", req.URL.Path, resp.StatusCode, duration, fields)
+	return resp, nil
+}
+
+func (t *casRetryTransport) roundTripWithRetries(req *http.Request, fields internal.LogFields) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		index := t.endpoints.current()
+		resp, err := t.roundTripWithTimeout(t.endpoints.rewrite(req, index))
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.endpoints.markHealthy(index)
+			return resp, nil
+		}
+
+		t.endpoints.markFailed(index, fields)
+
+		// CAS accepts a service ticket only once. A retry of a request which reached CAS would be rejected with
+		// INVALID_TICKET, so only requests which could not be delivered are retried.
+		if err == nil || attempt >= t.retries || !isNotDelivered(err) {
+			return resp, err
+		}
+
+		casRequestRetriesTotal.Add(1)
+		backoff := t.backoff(attempt)
+		casLog.Warningf("CAS request to %s failed, retry in %s: %s %v", req.URL.Path, backoff, err.Error(), fields)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// isNotDelivered reports whether a request failed before it was sent to CAS, e.g. because the connection was refused
+// or the host name could not be resolved.
+func isNotDelivered(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+func (t *casRetryTransport) roundTripWithTimeout(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff doubles the retry interval with every attempt and adds a jitter of +-50%.
+func (t *casRetryTransport) backoff(attempt int) time.Duration {
+	backoff := t.retryInterval << attempt
+	return backoff/2 + rand.N(backoff)
+}
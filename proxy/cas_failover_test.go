@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCasEndpoints(t *testing.T) {
+	t.Run("fail over to next CAS and recover after cooldown", func(t *testing.T) {
+		endpoints, err := newCasEndpoints([]string{"https://cas1/cas", "https://cas2/cas"}, time.Minute)
+		require.NoError(t, err)
+		now := time.Now()
+		endpoints.now = func() time.Time { return now }
+
+		endpoints.markFailed(0, internal.LogFields{})
+		login, err := endpoints.Login()
+
+		require.NoError(t, err)
+		assert.Equal(t, "https://cas2/cas/login", login.String())
+
+		now = now.Add(2 * time.Minute)
+		assert.Equal(t, 0, endpoints.current())
+	})
+
+	t.Run("use CAS which recovers first if all are unhealthy", func(t *testing.T) {
+		endpoints, err := newCasEndpoints([]string{"https://cas1/cas", "https://cas2/cas"}, time.Minute)
+		require.NoError(t, err)
+
+		assert.True(t, endpoints.Available())
+
+		endpoints.markFailed(1, internal.LogFields{})
+		endpoints.markFailed(0, internal.LogFields{})
+
+		assert.Equal(t, 1, endpoints.current())
+		assert.False(t, endpoints.Available())
+	})
+
+	t.Run("validate against p3 endpoint", func(t *testing.T) {
+		endpoints, err := newCasEndpoints([]string{"https://cas1/cas"}, 0)
+		require.NoError(t, err)
+
+		validate, err := endpoints.ServiceValidate()
+
+		require.NoError(t, err)
+		assert.Equal(t, "https://cas1/cas/p3/serviceValidate", validate.String())
+	})
+
+	t.Run("fail on invalid CAS url", func(t *testing.T) {
+		_, err := newCasEndpoints([]string{"https://cas1/cas", ":cas2"}, 0)
+
+		assert.ErrorContains(t, err, "failed to parse cas url: :cas2")
+	})
+}
+
+// unreachableURL returns the url of a closed port on which connections are refused.
+func unreachableURL(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	return "http://" + address
+}
+
+func TestCasRetryTransport(t *testing.T) {
+	t.Run("retry unreachable CAS on failover CAS", func(t *testing.T) {
+		var healthyCalls atomic.Int32
+		brokenCasURL := unreachableURL(t)
+		healthyCas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			healthyCalls.Add(1)
+			assert.Equal(t, "/cas/p3/serviceValidate", r.URL.Path)
+			assert.Equal(t, "ST-1", r.URL.Query().Get("ticket"))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer healthyCas.Close()
+
+		endpoints, err := newCasEndpoints([]string{brokenCasURL + "/cas", healthyCas.URL + "/cas"}, time.Minute)
+		require.NoError(t, err)
+		transport := newCasRetryTransport(http.DefaultTransport, endpoints, config.Configuration{CasRetries: 2, CasRetryInterval: time.Millisecond})
+
+		resp, err := (&http.Client{Transport: transport}).Get(brokenCasURL + "/cas/p3/serviceValidate?ticket=ST-1")
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(1), healthyCalls.Load())
+	})
+
+	t.Run("give up after retries", func(t *testing.T) {
+		casURL := unreachableURL(t)
+		endpoints, err := newCasEndpoints([]string{casURL + "/cas"}, time.Minute)
+		require.NoError(t, err)
+		transport := newCasRetryTransport(http.DefaultTransport, endpoints, config.Configuration{CasRetries: 2, CasRetryInterval: time.Millisecond})
+		failuresBefore := casRequestFailuresTotal.Value()
+		retriesBefore := casRequestRetriesTotal.Value()
+
+		_, err = (&http.Client{Transport: transport}).Get(casURL + "/cas/p3/serviceValidate")
+
+		assert.ErrorContains(t, err, "connection refused")
+		assert.Equal(t, retriesBefore+2, casRequestRetriesTotal.Value())
+		assert.Equal(t, failuresBefore+1, casRequestFailuresTotal.Value())
+	})
+
+	t.Run("do not retry validation which reached CAS", func(t *testing.T) {
+		var calls atomic.Int32
+		cas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer cas.Close()
+
+		endpoints, err := newCasEndpoints([]string{cas.URL + "/cas"}, time.Minute)
+		require.NoError(t, err)
+		transport := newCasRetryTransport(http.DefaultTransport, endpoints, config.Configuration{CasRetries: 2, CasRetryInterval: time.Millisecond})
+
+		resp, err := (&http.Client{Transport: transport}).Get(cas.URL + "/cas/p3/serviceValidate?ticket=ST-1")
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("keep CAS healthy on ticket rejection", func(t *testing.T) {
+		cas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"><cas:authenticationFailure code="INVALID_TICKET"/></cas:serviceResponse>`))
+		}))
+		defer cas.Close()
+
+		endpoints, err := newCasEndpoints([]string{cas.URL + "/cas", unreachableURL(t) + "/cas"}, time.Minute)
+		require.NoError(t, err)
+		transport := newCasRetryTransport(http.DefaultTransport, endpoints, config.Configuration{CasRetries: 2, CasRetryInterval: time.Millisecond})
+
+		resp, err := (&http.Client{Transport: transport}).Get(cas.URL + "/cas/p3/serviceValidate?ticket=ST-1")
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, 0, endpoints.current())
+	})
+
+	t.Run("fail on timeout", func(t *testing.T) {
+		cas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer cas.Close()
+
+		endpoints, err := newCasEndpoints([]string{cas.URL + "/cas"}, time.Minute)
+		require.NoError(t, err)
+		transport := newCasRetryTransport(http.DefaultTransport, endpoints, config.Configuration{CasTimeout: 10 * time.Millisecond})
+		failuresBefore := casRequestFailuresTotal.Value()
+
+		_, err = (&http.Client{Transport: transport}).Get(cas.URL + "/cas/p3/serviceValidate")
+
+		assert.ErrorContains(t, err, "context deadline exceeded")
+		assert.Equal(t, failuresBefore+1, casRequestFailuresTotal.Value())
+	})
+
+	t.Run("add jitter to exponential backoff", func(t *testing.T) {
+		transport := &casRetryTransport{retryInterval: 100 * time.Millisecond}
+
+		for range 20 {
+			backoff := transport.backoff(2)
+			assert.GreaterOrEqual(t, backoff, 200*time.Millisecond)
+			assert.Less(t, backoff, 600*time.Millisecond)
+		}
+	})
+}
+
+func TestValidationRequests(t *testing.T) {
+	var validations validationRequests
+	var fields internal.LogFields
+	casReq := httptest.NewRequest(http.MethodGet, "https://cas.example.com/cas/p3/serviceValidate?service=x&ticket=ST-1-abc", nil)
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		fields = validations.logFields(casReq)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/sonar/projects?ticket=ST-1-abc", nil)
+	req = req.WithContext(internal.WithRequestID(req.Context(), "req-1"))
+
+	validations.Middleware(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "req-1", fields["requestId"])
+	assert.Empty(t, validations.logFields(casReq), "ticket must be released after the validation")
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+// createCasHttpClient creates the client which go-cas uses to validate tickets. The CAS certificate is verified
+// against the system pool extended by cas-ca-file unless skip-ssl-verification is set. Requests to the hosts of
+// cas-server-names use the configured TLS server name.
+func createCasHttpClient(configuration config.Configuration) (*http.Client, error) {
+	tlsConfig, err := createCasTLSConfig(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := serverNameTransport{
+		transports: map[string]http.RoundTripper{},
+		fallback:   newCasTransport(tlsConfig, ""),
+	}
+	for host, serverName := range configuration.CasServerNames {
+		transport.transports[host] = newCasTransport(tlsConfig, serverName)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func newCasTransport(tlsConfig *tls.Config, serverName string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig.Clone()
+	transport.TLSClientConfig.ServerName = serverName
+
+	return transport
+}
+
+// serverNameTransport sends requests with the transport of their host, so that each CAS of a failover setup is
+// verified against its own server name.
+type serverNameTransport struct {
+	transports map[string]http.RoundTripper
+	fallback   http.RoundTripper
+}
+
+func (t serverNameTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.transports[req.URL.Hostname()]; ok {
+		return transport.RoundTrip(req)
+	}
+
+	return t.fallback.RoundTrip(req)
+}
+
+func createCasTLSConfig(configuration config.Configuration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if configuration.SkipSSLVerification {
+		casLog.Warning("!!! skip-ssl-verification is enabled: the CAS certificate is NOT verified and tickets may be validated " +
+			"against an impostor. Never use this option in production, configure cas-ca-file instead !!!")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if configuration.CasCAFile != "" {
+		pool, err := loadCertPool(configuration.CasCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if configuration.CasClientCertFile != "" || configuration.CasClientKeyFile != "" {
+		if configuration.CasClientCertFile == "" || configuration.CasClientKeyFile == "" {
+			return nil, fmt.Errorf("cas-client-cert-file and cas-client-key-file must be set together")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(configuration.CasClientCertFile, configuration.CasClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CAS client certificate '%s': %w", configuration.CasClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCertPool appends the PEM certificates of caFile to the system pool.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.Warningf("failed to load system cert pool, only trust certificates of %s: %s", caFile, err.Error())
+		pool = x509.NewCertPool()
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file '%s': %w", caFile, err)
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file '%s' contains no PEM certificate", caFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCasHttpClient(t *testing.T) {
+	casServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer casServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: casServer.Certificate().Raw}), 0600))
+
+	t.Run("reject unknown CA", func(t *testing.T) {
+		client, err := createCasHttpClient(config.Configuration{})
+		require.NoError(t, err)
+
+		_, err = client.Get(casServer.URL)
+
+		assert.ErrorContains(t, err, "certificate")
+	})
+
+	t.Run("trust CA of cas-ca-file with SNI override", func(t *testing.T) {
+		client, err := createCasHttpClient(config.Configuration{CasCAFile: caFile, CasServerNames: map[string]string{"127.0.0.1": "example.com"}})
+		require.NoError(t, err)
+
+		resp, err := client.Get(casServer.URL)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("use SNI override only for its host", func(t *testing.T) {
+		client, err := createCasHttpClient(config.Configuration{CasCAFile: caFile, CasServerNames: map[string]string{"cas2.example.com": "cas.invalid"}})
+		require.NoError(t, err)
+
+		resp, err := client.Get(casServer.URL)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("verify server name of override", func(t *testing.T) {
+		client, err := createCasHttpClient(config.Configuration{CasCAFile: caFile, CasServerNames: map[string]string{"127.0.0.1": "cas.invalid"}})
+		require.NoError(t, err)
+
+		_, err = client.Get(casServer.URL)
+
+		assert.ErrorContains(t, err, "cas.invalid")
+	})
+
+	t.Run("skip verification", func(t *testing.T) {
+		client, err := createCasHttpClient(config.Configuration{SkipSSLVerification: true})
+		require.NoError(t, err)
+
+		resp, err := client.Get(casServer.URL)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+}
+
+func TestCreateCasTLSConfig(t *testing.T) {
+	t.Run("load client certificate", func(t *testing.T) {
+		certFile, keyFile := writeCertificate(t, t.TempDir(), "carp", time.Now())
+
+		tlsConfig, err := createCasTLSConfig(config.Configuration{CasClientCertFile: certFile, CasClientKeyFile: keyFile})
+
+		require.NoError(t, err)
+		assert.Len(t, tlsConfig.Certificates, 1)
+		assert.False(t, tlsConfig.InsecureSkipVerify)
+	})
+
+	t.Run("fail on client certificate without key", func(t *testing.T) {
+		_, err := createCasTLSConfig(config.Configuration{CasClientCertFile: "client.crt"})
+
+		assert.ErrorContains(t, err, "cas-client-cert-file and cas-client-key-file must be set together")
+	})
+
+	t.Run("fail on CA file without certificates", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, []byte("no certificate"), 0600))
+
+		_, err := createCasTLSConfig(config.Configuration{CasCAFile: caFile})
+
+		assert.ErrorContains(t, err, "contains no PEM certificate")
+	})
+}
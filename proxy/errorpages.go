@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	errorPageName        = "error.html"
+	defaultErrorLanguage = "en"
+	// statusClientClosedRequest is logged if the client cancelled the request before SonarQube answered.
+	statusClientClosedRequest = 499
+)
+
+type errorKind string
+
+const (
+	errorUpstreamUnavailable errorKind = "upstream-unavailable"
+	errorUpstreamTimeout     errorKind = "upstream-timeout"
+	errorCasUnavailable      errorKind = "cas-unavailable"
+)
+
+var errorStatusCodes = map[errorKind]int{
+	errorUpstreamUnavailable: http.StatusBadGateway,
+	errorUpstreamTimeout:     http.StatusGatewayTimeout,
+	errorCasUnavailable:      http.StatusServiceUnavailable,
+}
+
+type errorText struct {
+	Title   string
+	Message string
+}
+
+type errorLabels struct {
+	Status    string
+	RequestID string
+}
+
+var errorTexts = map[string]map[errorKind]errorText{
+	"en": {
+		errorUpstreamUnavailable: {"SonarQube is not reachable", "SonarQube did not answer the request. Please try again in a few minutes."},
+		errorUpstreamTimeout:     {"SonarQube is not responding", "SonarQube did not answer in time. Please try again later."},
+		errorCasUnavailable:      {"Login is unavailable", "The login service (CAS) is not reachable. Please try again in a few minutes."},
+	},
+	"de": {
+		errorUpstreamUnavailable: {"SonarQube ist nicht erreichbar", "SonarQube hat die Anfrage nicht beantwortet. Bitte versuchen Sie es in einigen Minuten erneut."},
+		errorUpstreamTimeout:     {"SonarQube antwortet nicht", "SonarQube hat nicht rechtzeitig geantwortet. Bitte versuchen Sie es später erneut."},
+		errorCasUnavailable:      {"Anmeldung nicht möglich", "Der Anmeldedienst (CAS) ist nicht erreichbar. Bitte versuchen Sie es in einigen Minuten erneut."},
+	},
+}
+
+var errorPageLabels = map[string]errorLabels{
+	"en": {Status: "Status", RequestID: "Request ID"},
+	"de": {Status: "Status", RequestID: "Anfrage-ID"},
+}
+
+type errorPageData struct {
+	pageData
+	Lang           string
+	Title          string
+	Message        string
+	StatusCode     int
+	StatusLabel    string
+	RequestIDLabel string
+}
+
+// errorPages renders localized error pages for browsers and JSON errors for API clients.
+type errorPages struct {
+	pages pageRenderer
+}
+
+func newErrorPages(pages pageRenderer) errorPages {
+	return errorPages{pages: pages}
+}
+
+func (e errorPages) ServeError(writer http.ResponseWriter, req *http.Request, kind errorKind) {
+	statusCode := errorStatusCodes[kind]
+	lang := preferredLanguage(req.Header.Get("Accept-Language"))
+	text := errorTexts[lang][kind]
+
+	if isAPIRequest(req) {
+		writeJSON(writer, statusCode, map[string]any{
+			"status":    statusCode,
+			"error":     string(kind),
+			"message":   text.Message,
+			"requestId": requestID(req),
+		})
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(statusCode)
+
+	labels := errorPageLabels[lang]
+	err := e.pages.render(writer, errorPageName, errorPageData{
+		pageData:       e.pages.pageData(req),
+		Lang:           lang,
+		Title:          text.Title,
+		Message:        text.Message,
+		StatusCode:     statusCode,
+		StatusLabel:    labels.Status,
+		RequestIDLabel: labels.RequestID,
+	})
+	if err != nil {
+		log.Errorf("failed to render error page: %s %v", err.Error(), requestLogFields(req))
+	}
+}
+
+// ServeUpstreamError is the error handler of the forwarder. Timeouts result in 504, request bodies cut off by the
+// requestBodyLimiter in 413 and all other errors in 502.
+func (e errorPages) ServeUpstreamError(writer http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		log.Debugf("client cancelled request to SonarQube: %s %v", err.Error(), requestLogFields(req))
+		writer.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		log.Warningf("reject request body which exceeds the limit of %d bytes %v", maxBytesErr.Limit, requestLogFields(req))
+		http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	log.Errorf("failed to forward request to SonarQube: %s %v", err.Error(), requestLogFields(req))
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		e.ServeError(writer, req, errorUpstreamTimeout)
+		return
+	}
+
+	e.ServeError(writer, req, errorUpstreamUnavailable)
+}
+
+type casAvailability interface {
+	Available() bool
+}
+
+// casOutageMiddleware shows an error page instead of redirecting unauthenticated users to a CAS which is known to be
+// down. Authenticated users keep working with their session.
+func casOutageMiddleware(casStatus casAvailability, pages errorPages, isAuthenticated func(r *http.Request) bool) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			if isAuthenticated(req) || isAnonymousRequest(req) || casStatus.Available() {
+				next.ServeHTTP(writer, req)
+				return
+			}
+
+			casLog.Warningf("CAS is unavailable, serve error page instead of login redirect %v", requestLogFields(req))
+			pages.ServeError(writer, req, errorCasUnavailable)
+		})
+	}
+}
+
+// preferredLanguage returns the supported language with the highest quality of an Accept-Language header.
+func preferredLanguage(acceptLanguage string) string {
+	best := defaultErrorLanguage
+	bestQuality := -1.0
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+
+		quality := 1.0
+		if qValue, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(qValue, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		if _, supported := errorTexts[lang]; supported && quality > bestQuality {
+			best = lang
+			bestQuality = quality
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type casAvailabilityStub bool
+
+func (c casAvailabilityStub) Available() bool {
+	return bool(c)
+}
+
+func newErrorRequest(target string, acceptLanguage string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept-Language", acceptLanguage)
+	return req.WithContext(internal.WithRequestID(req.Context(), "req-42"))
+}
+
+func TestErrorPages_ServeError(t *testing.T) {
+	pages := newErrorPages(createPageRenderer(t, "", nil))
+
+	t.Run("serve german page with request id", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+
+		pages.ServeError(recorder, newErrorRequest("/sonar/projects", "de-DE,de;q=0.9,en;q=0.8"), errorUpstreamUnavailable)
+
+		assert.Equal(t, http.StatusBadGateway, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Contains(t, recorder.Body.String(), `<html lang="de">`)
+		assert.Contains(t, recorder.Body.String(), "SonarQube ist nicht erreichbar")
+		assert.Contains(t, recorder.Body.String(), "<code>req-42</code>")
+	})
+
+	t.Run("serve english page by default", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+
+		pages.ServeError(recorder, newErrorRequest("/sonar/projects", "fr-FR"), errorCasUnavailable)
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "Login is unavailable")
+	})
+
+	t.Run("serve JSON to API clients", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+
+		pages.ServeError(recorder, newErrorRequest("/sonar/api/projects/search", "en"), errorUpstreamTimeout)
+
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, float64(http.StatusGatewayTimeout), body["status"])
+		assert.Equal(t, "upstream-timeout", body["error"])
+		assert.Equal(t, "req-42", body["requestId"])
+		assert.NotEmpty(t, body["message"])
+	})
+}
+
+func TestErrorPages_ServeUpstreamError(t *testing.T) {
+	pages := newErrorPages(createPageRenderer(t, "", nil))
+
+	tests := []struct {
+		name       string
+		err        error
+		wantedCode int
+	}{
+		{"connection refused", errors.New("dial tcp 127.0.0.1:9000: connect: connection refused"), http.StatusBadGateway},
+		{"timeout", fmt.Errorf("waiting for headers: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"client cancelled", context.Canceled, statusClientClosedRequest},
+		{"request body too large", fmt.Errorf("write body: %w", &http.MaxBytesError{Limit: 10}), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			pages.ServeUpstreamError(recorder, newErrorRequest("/sonar/", ""), tt.err)
+
+			assert.Equal(t, tt.wantedCode, recorder.Code)
+		})
+	}
+}
+
+func TestCasOutageMiddleware(t *testing.T) {
+	pages := newErrorPages(createPageRenderer(t, "", nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		available     bool
+		authenticated bool
+		wantedCode    int
+	}{
+		{"redirect to available CAS", true, false, http.StatusNoContent},
+		{"keep authenticated users working", false, true, http.StatusNoContent},
+		{"serve error page instead of login", false, false, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			isAuthenticated := func(*http.Request) bool { return tt.authenticated }
+
+			casOutageMiddleware(casAvailabilityStub(tt.available), pages, isAuthenticated)(next).ServeHTTP(recorder, newErrorRequest("/sonar/", ""))
+
+			assert.Equal(t, tt.wantedCode, recorder.Code)
+		})
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"fr;q=1.0, en;q=0.5, de;q=0.8", "de"},
+		{"de;q=0, en", "en"},
+		{"es, fr", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.want, preferredLanguage(tt.acceptLanguage))
+		})
+	}
+
+	t.Run("translate every error", func(t *testing.T) {
+		for lang, texts := range errorTexts {
+			for kind := range errorStatusCodes {
+				assert.NotEmpty(t, texts[kind].Message, "missing %s text for %s", lang, kind)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	gatewayCookieName             = "_carp_gateway"
+	defaultGatewayLoginPath       = "/sonar/sessions/new"
+	defaultGatewayRecheckInterval = 10 * time.Minute
+)
+
+type anonymousContextKey int
+
+const anonymousKey anonymousContextKey = iota
+
+// withAnonymous marks a request to be forwarded to SonarQube without authentication.
+func withAnonymous(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), anonymousKey, true))
+}
+
+func isAnonymousRequest(r *http.Request) bool {
+	anonymous, _ := r.Context().Value(anonymousKey).(bool)
+	return anonymous
+}
+
+// gatewayMode lets users browse SonarQube anonymously. Browser navigation is sent once to CAS with gateway=true so
+// that users with a CAS session are logged in silently, CAS redirects everyone else back without a ticket. The
+// result is remembered in a cookie until the recheck interval expired. Only SonarQube's login page forces the login.
+type gatewayMode struct {
+	loginPath       string
+	cookiePath      string
+	recheckInterval time.Duration
+	loginURL        func(r *http.Request) (string, error)
+	casStatus       casAvailability
+	isAuthenticated func(r *http.Request) bool
+}
+
+func newGatewayMode(loginPath string, baseURL string, recheckInterval time.Duration, loginURL func(r *http.Request) (string, error), casStatus casAvailability, isAuthenticated func(r *http.Request) bool) gatewayMode {
+	if loginPath == "" {
+		loginPath = defaultGatewayLoginPath
+	}
+
+	cookiePath := "/"
+	if parsedBaseURL, err := url.Parse(baseURL); err == nil && parsedBaseURL.Path != "" {
+		cookiePath = parsedBaseURL.Path
+	}
+
+	return gatewayMode{
+		loginPath:       loginPath,
+		cookiePath:      cookiePath,
+		recheckInterval: durationOrDefault(recheckInterval, defaultGatewayRecheckInterval),
+		loginURL:        loginURL,
+		casStatus:       casStatus,
+		isAuthenticated: isAuthenticated,
+	}
+}
+
+func (g gatewayMode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if g.isAuthenticated(req) || strings.HasPrefix(req.URL.Path, g.loginPath) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		if g.shouldTryGateway(req) {
+			gatewayURL, err := g.gatewayURL(req)
+			if err == nil {
+				casLog.Debugf("check CAS session with gateway request %v", requestLogFields(req))
+				g.remember(writer)
+				http.Redirect(writer, req, gatewayURL, http.StatusFound)
+				return
+			}
+
+			casLog.Errorf("failed to create CAS gateway url, continue anonymously: %s %v", err.Error(), requestLogFields(req))
+		}
+
+		next.ServeHTTP(writer, withAnonymous(req))
+	})
+}
+
+func (g gatewayMode) shouldTryGateway(req *http.Request) bool {
+	if req.Method != http.MethodGet || isAPIRequest(req) || !g.casStatus.Available() {
+		return false
+	}
+
+	_, err := req.Cookie(gatewayCookieName)
+	return err != nil
+}
+
+func (g gatewayMode) gatewayURL(req *http.Request) (string, error) {
+	loginURL, err := g.loginURL(req)
+	if err != nil {
+		return "", err
+	}
+
+	gatewayURL, err := url.Parse(loginURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := gatewayURL.Query()
+	query.Set("gateway", "true")
+	gatewayURL.RawQuery = query.Encode()
+
+	return gatewayURL.String(), nil
+}
+
+// remember stores that the CAS session was checked so that anonymous users are not redirected on every request.
+func (g gatewayMode) remember(writer http.ResponseWriter) {
+	http.SetCookie(writer, &http.Cookie{
+		Name:     gatewayCookieName,
+		Value:    "1",
+		Path:     g.cookiePath,
+		MaxAge:   int(g.recheckInterval.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
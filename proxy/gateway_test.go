@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createGatewayMode(authenticated bool, casAvailable bool) gatewayMode {
+	loginURL := func(r *http.Request) (string, error) {
+		return "https://ces.example.com/cas/login?service=https%3A%2F%2Fces.example.com" + r.URL.Path, nil
+	}
+	isAuthenticated := func(*http.Request) bool { return authenticated }
+
+	return newGatewayMode("", "https://ces.example.com/sonar/", 0, loginURL, casAvailabilityStub(casAvailable), isAuthenticated)
+}
+
+func TestGatewayMode_Middleware(t *testing.T) {
+	var anonymous, called bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		anonymous = isAnonymousRequest(r)
+	})
+	serve := func(gateway gatewayMode, req *http.Request) *httptest.ResponseRecorder {
+		called, anonymous = false, false
+		recorder := httptest.NewRecorder()
+		gateway.Middleware(next).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("check CAS session with gateway request", func(t *testing.T) {
+		recorder := serve(createGatewayMode(false, true), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, "https://ces.example.com/cas/login?gateway=true&service=https%3A%2F%2Fces.example.com%2Fsonar%2Fprojects", recorder.Header().Get("Location"))
+		cookie := recorder.Result().Cookies()[0]
+		assert.Equal(t, gatewayCookieName, cookie.Name)
+		assert.Equal(t, "/sonar/", cookie.Path)
+		assert.Equal(t, int(defaultGatewayRecheckInterval.Seconds()), cookie.MaxAge)
+		assert.True(t, cookie.HttpOnly)
+	})
+
+	t.Run("browse anonymously after gateway request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/sonar/projects", nil)
+		req.AddCookie(&http.Cookie{Name: gatewayCookieName, Value: "1"})
+
+		serve(createGatewayMode(false, true), req)
+
+		assert.True(t, called)
+		assert.True(t, anonymous)
+	})
+
+	t.Run("browse anonymously with API request", func(t *testing.T) {
+		serve(createGatewayMode(false, true), httptest.NewRequest(http.MethodGet, "/sonar/api/components/search", nil))
+
+		assert.True(t, called)
+		assert.True(t, anonymous)
+	})
+
+	t.Run("browse anonymously if CAS is unavailable", func(t *testing.T) {
+		serve(createGatewayMode(false, false), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		assert.True(t, called)
+		assert.True(t, anonymous)
+	})
+
+	t.Run("force CAS login on SonarQube's login page", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/sonar/sessions/new?return_to=%2Fsonar%2Fprojects", nil)
+		req.AddCookie(&http.Cookie{Name: gatewayCookieName, Value: "1"})
+
+		serve(createGatewayMode(false, true), req)
+
+		assert.True(t, called)
+		assert.False(t, anonymous)
+	})
+
+	t.Run("pass authenticated users", func(t *testing.T) {
+		serve(createGatewayMode(true, true), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		assert.True(t, called)
+		assert.False(t, anonymous)
+	})
+
+	t.Run("continue anonymously if gateway url fails", func(t *testing.T) {
+		gateway := createGatewayMode(false, true)
+		gateway.loginURL = func(*http.Request) (string, error) { return "", errors.New("no CAS") }
+
+		serve(gateway, httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		assert.True(t, called)
+		assert.True(t, anonymous)
+	})
+}
+
+func TestNewGatewayMode(t *testing.T) {
+	gateway := newGatewayMode("/sonar/login", "http://localhost:8080", time.Minute, nil, casAvailabilityStub(true), nil)
+
+	require.Equal(t, "/sonar/login", gateway.loginPath)
+	assert.Equal(t, "/", gateway.cookiePath)
+	assert.Equal(t, time.Minute, gateway.recheckInterval)
+}
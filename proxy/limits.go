@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+const (
+	defaultReadHeaderTimeout   = 10 * time.Second
+	defaultReadTimeout         = 5 * time.Minute
+	defaultIdleTimeout         = 2 * time.Minute
+	defaultMaxHeaderBytes      = 1 << 20
+	defaultMaxRequestBodyBytes = 10 << 20
+)
+
+// defaultRequestBodyLimits keeps scanner uploads unlimited, with and without context path. They are checked after the
+// configured request-body-limits, so that configured limits can override them.
+var defaultRequestBodyLimits = []config.RequestBodyLimit{
+	{PathPattern: "/*/api/ce/submit", MaxBytes: -1},
+	{PathPattern: "/api/ce/submit", MaxBytes: -1},
+}
+
+// applyServerLimits sets the timeouts and header limit of the server. Unset values get safe defaults.
+func applyServerLimits(server *http.Server, configuration config.Configuration) {
+	server.ReadHeaderTimeout = durationOrDefault(configuration.ServerReadHeaderTimeout, defaultReadHeaderTimeout)
+	server.ReadTimeout = durationOrDefault(configuration.ServerReadTimeout, defaultReadTimeout)
+	server.IdleTimeout = durationOrDefault(configuration.ServerIdleTimeout, defaultIdleTimeout)
+
+	server.MaxHeaderBytes = defaultMaxHeaderBytes
+	if configuration.ServerMaxHeaderBytes > 0 {
+		server.MaxHeaderBytes = configuration.ServerMaxHeaderBytes
+	}
+}
+
+// requestBodyLimiter limits the request body size. The first limit whose path pattern matches the request path is
+// used, otherwise the default limit. A negative size disables the limit and 0 selects the default. Requests without
+// limit are uploads which may take long, so the read timeout of the server is lifted for them, too.
+type requestBodyLimiter struct {
+	defaultMaxBytes int64
+	limits          []config.RequestBodyLimit
+}
+
+func newRequestBodyLimiter(defaultMaxBytes int64, limits []config.RequestBodyLimit) *requestBodyLimiter {
+	if defaultMaxBytes == 0 {
+		defaultMaxBytes = defaultMaxRequestBodyBytes
+	}
+
+	return &requestBodyLimiter{defaultMaxBytes: defaultMaxBytes, limits: append(append([]config.RequestBodyLimit{}, limits...), defaultRequestBodyLimits...)}
+}
+
+func (l *requestBodyLimiter) maxBytes(requestPath string) int64 {
+	for _, limit := range l.limits {
+		if matched, _ := path.Match(limit.PathPattern, requestPath); matched {
+			if limit.MaxBytes == 0 {
+				return l.defaultMaxBytes
+			}
+			return limit.MaxBytes
+		}
+	}
+
+	return l.defaultMaxBytes
+}
+
+func (l *requestBodyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		maxBytes := l.maxBytes(req.URL.Path)
+		if maxBytes < 0 {
+			if err := http.NewResponseController(writer).SetReadDeadline(time.Time{}); err != nil {
+				log.Warningf("could not lift read timeout for upload: %s %v", err.Error(), requestLogFields(req))
+			}
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		if req.ContentLength > maxBytes {
+			log.Warningf("reject request body of %d bytes, the limit is %d bytes %v", req.ContentLength, maxBytes, requestLogFields(req))
+			http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// bodies without content length are cut off while they are read
+		req.Body = http.MaxBytesReader(writer, req.Body, maxBytes)
+		next.ServeHTTP(writer, req)
+	})
+}
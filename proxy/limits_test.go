@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vulcand/oxy/v2/forward"
+)
+
+func TestApplyServerLimits(t *testing.T) {
+	t.Run("apply defaults", func(t *testing.T) {
+		server := &http.Server{}
+
+		applyServerLimits(server, config.Configuration{})
+
+		assert.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+		assert.Equal(t, defaultReadTimeout, server.ReadTimeout)
+		assert.Equal(t, defaultIdleTimeout, server.IdleTimeout)
+		assert.Equal(t, defaultMaxHeaderBytes, server.MaxHeaderBytes)
+	})
+
+	t.Run("apply configured limits", func(t *testing.T) {
+		server := &http.Server{}
+
+		applyServerLimits(server, config.Configuration{
+			ServerReadHeaderTimeout: time.Second,
+			ServerReadTimeout:       2 * time.Second,
+			ServerIdleTimeout:       3 * time.Second,
+			ServerMaxHeaderBytes:    4096,
+		})
+
+		assert.Equal(t, time.Second, server.ReadHeaderTimeout)
+		assert.Equal(t, 2*time.Second, server.ReadTimeout)
+		assert.Equal(t, 3*time.Second, server.IdleTimeout)
+		assert.Equal(t, 4096, server.MaxHeaderBytes)
+	})
+}
+
+func TestRequestBodyLimiter(t *testing.T) {
+	readBody := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	limiter := newRequestBodyLimiter(10, []config.RequestBodyLimit{
+		{PathPattern: "/sonar/api/ce/submit", MaxBytes: -1},
+		{PathPattern: "/sonar/api/*/upload", MaxBytes: 20},
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		chunked    bool
+		wantedCode int
+	}{
+		{"accept small body", "/sonar/api/issues/do_transition", "0123456789", false, http.StatusNoContent},
+		{"reject large body by content length", "/sonar/api/issues/do_transition", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"reject large body without content length", "/sonar/api/issues/do_transition", "0123456789a", true, http.StatusRequestEntityTooLarge},
+		{"use limit of matching pattern", "/sonar/api/plugins/upload", "0123456789abcdefghij", false, http.StatusNoContent},
+		{"allow unlimited upload", "/sonar/api/ce/submit", strings.Repeat("x", 1000), false, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+
+			limiter.Middleware(readBody).ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantedCode, recorder.Code)
+		})
+	}
+
+	t.Run("keep scanner uploads unlimited by default", func(t *testing.T) {
+		assert.Equal(t, int64(-1), newRequestBodyLimiter(0, nil).maxBytes("/sonar/api/ce/submit"))
+		assert.Equal(t, int64(defaultMaxRequestBodyBytes), newRequestBodyLimiter(0, nil).maxBytes("/sonar/api/projects/create"))
+	})
+
+	t.Run("keep scanner uploads unlimited without context path", func(t *testing.T) {
+		assert.Equal(t, int64(-1), newRequestBodyLimiter(0, nil).maxBytes("/api/ce/submit"))
+	})
+
+	t.Run("keep scanner uploads unlimited with configured limits", func(t *testing.T) {
+		limiter := newRequestBodyLimiter(0, []config.RequestBodyLimit{{PathPattern: "/sonar/api/*/upload", MaxBytes: 20}})
+
+		assert.Equal(t, int64(-1), limiter.maxBytes("/sonar/api/ce/submit"))
+		assert.Equal(t, int64(20), limiter.maxBytes("/sonar/api/plugins/upload"))
+	})
+
+	t.Run("override scanner upload limit", func(t *testing.T) {
+		limiter := newRequestBodyLimiter(0, []config.RequestBodyLimit{{PathPattern: "/sonar/api/ce/submit", MaxBytes: 1 << 30}})
+
+		assert.Equal(t, int64(1<<30), limiter.maxBytes("/sonar/api/ce/submit"))
+	})
+}
+
+func TestRequestBodyLimiter_server(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	fwd := forward.New(true)
+	fwd.ErrorHandler = newErrorPages(createPageRenderer(t, "", nil)).ServeUpstreamError
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme, r.URL.Host = upstreamURL.Scheme, upstreamURL.Host
+		fwd.ServeHTTP(w, r)
+	})
+
+	server := httptest.NewUnstartedServer(newRequestBodyLimiter(10, nil).Middleware(proxy))
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	t.Run("answer chunked body over the limit with 413", func(t *testing.T) {
+		// a reader without length is sent chunked
+		body := io.MultiReader(strings.NewReader(strings.Repeat("x", 100)))
+
+		resp, err := http.Post(server.URL+"/sonar/api/issues/do_transition", "text/plain", body)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	t.Run("lift read timeout for slow uploads", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		go func() {
+			_, _ = writer.Write([]byte("part 1"))
+			time.Sleep(400 * time.Millisecond)
+			_, _ = writer.Write([]byte("part 2"))
+			_ = writer.Close()
+		}()
+
+		resp, err := http.Post(server.URL+"/sonar/api/ce/submit", "text/plain", reader)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+}
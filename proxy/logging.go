@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+
+	"github.com/cloudogu/go-cas"
+	"github.com/cloudogu/sonarcarp/internal"
 )
 
 type statusResponseWriter struct {
@@ -17,6 +20,16 @@ func (s *statusResponseWriter) WriteHeader(code int) {
 	s.ResponseWriter.WriteHeader(code)
 }
 
+// Flush sends the buffered data of streamed responses to the client.
+func (s *statusResponseWriter) Flush() {
+	_ = http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer, e.g. to set deadlines.
+func (s *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
 // Hijack enables support for websockets
 func (s *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	h, ok := s.ResponseWriter.(http.Hijacker)
@@ -36,9 +49,28 @@ func loggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(srw, request)
 
-		log.Infof("%d %s %s", srw.httpStatusCode, request.Method, request.URL.Path)
+		fields := requestLogFields(request)
+		accessLog.Infof("%d %s %s %v", srw.httpStatusCode, request.Method, request.URL.Path, fields)
 		if srw.httpStatusCode >= 300 {
-			log.Infof("request headers: %#v", srw.Header())
+			accessLog.Infof("request headers: %#v %v", srw.Header(), fields)
 		}
 	})
 }
+
+// requestLogFields returns the structured log fields describing the request.
+func requestLogFields(r *http.Request) internal.LogFields {
+	fields := internal.LogFields{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}
+
+	if principal := cas.Username(r); principal != "" {
+		fields["principal"] = principal
+	}
+
+	if requestID := requestID(r); requestID != "" {
+		fields["requestId"] = requestID
+	}
+
+	return fields
+}
@@ -25,6 +25,15 @@ func TestStatusResponseWriter_WriteHeader(t *testing.T) {
 	assert.Equal(t, 200, rwMock.Code)
 }
 
+func TestStatusResponseWriter_Flush(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	sw := &statusResponseWriter{ResponseWriter: recorder, httpStatusCode: http.StatusOK}
+
+	require.NoError(t, http.NewResponseController(sw).Flush())
+
+	assert.True(t, recorder.Flushed)
+}
+
 func TestLoggingMiddleware(t *testing.T) {
 	mh := &mocks.Handler{
 		MserveHTTP: func(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +44,7 @@ func TestLoggingMiddleware(t *testing.T) {
 
 	mh.On("ServeHTTP", mock.Anything, mock.Anything)
 
-	lm, reset := mocks.CreateLoggingMock(log)
+	lm, reset := mocks.CreateLoggingMock(accessLog)
 	defer reset()
 
 	h := loggingMiddleware(mh)
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const (
+	carpLogLevelPathSuffix      = "carp/log-level"
+	defaultLogLevelResetTimeout = 15 * time.Minute
+)
+
+type logLevelRequest struct {
+	Module   string `json:"module"`
+	Level    string `json:"level"`
+	Duration string `json:"duration"`
+}
+
+// logLevelHandler lets CES administrators change the log level of a module for a limited time.
+type logLevelHandler struct {
+	path         string
+	origin       *url.URL
+	adminGroup   string
+	resetTimeout time.Duration
+	currentUser  func(r *http.Request) (internal.User, bool)
+	setLevel     func(module string, level string, revertAfter time.Duration) error
+	levels       func() map[string]string
+}
+
+func newLogLevelHandler(baseURL string, adminGroup string, resetTimeout time.Duration) (logLevelHandler, error) {
+	logLevelPath, err := carpPath(baseURL, carpLogLevelPathSuffix)
+	if err != nil {
+		return logLevelHandler{}, err
+	}
+
+	origin, err := url.Parse(baseURL)
+	if err != nil {
+		return logLevelHandler{}, fmt.Errorf("could not parse base url '%s': %w", baseURL, err)
+	}
+
+	if resetTimeout <= 0 {
+		resetTimeout = defaultLogLevelResetTimeout
+	}
+
+	return logLevelHandler{
+		path:         logLevelPath,
+		origin:       origin,
+		adminGroup:   adminGroup,
+		resetTimeout: resetTimeout,
+		currentUser:  casUser,
+		setLevel:     config.SetModuleLogLevel,
+		levels:       config.ModuleLogLevels,
+	}, nil
+}
+
+// Middleware serves the log level endpoint and passes all other requests on.
+func (l logLevelHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != l.path {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		user, authenticated := l.currentUser(req)
+		if !authenticated {
+			// let the proxy handler redirect to the CAS login first
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		if !isMemberOf(user, l.adminGroup) {
+			log.Warningf("user %s is not allowed to change log levels %v", user.UserName, requestLogFields(req))
+			audit(req, auditEventAccessDenied, auditOutcomeFailure, "log level api requires admin group")
+			writeJSON(writer, http.StatusForbidden, map[string]string{"error": "only administrators may change log levels"})
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, l.levels())
+		case http.MethodPut, http.MethodPost:
+			l.changeLevel(writer, req, user)
+		default:
+			writer.Header().Set("Allow", "GET, PUT, POST")
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (l logLevelHandler) changeLevel(writer http.ResponseWriter, req *http.Request, user internal.User) {
+	// log levels must not be changed by forged requests of foreign pages an admin visits
+	if !isSameOrigin(req, l.origin) {
+		log.Warningf("reject log level change of user %s from foreign origin '%s' %v", user.UserName, req.Header.Get("Origin"), requestLogFields(req))
+		audit(req, auditEventAccessDenied, auditOutcomeFailure, "log level change from foreign origin")
+		writeJSON(writer, http.StatusForbidden, map[string]string{"error": "log levels can only be changed from the SonarQube origin"})
+		return
+	}
+
+	var body logLevelRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %s", err.Error())})
+		return
+	}
+
+	revertAfter := l.resetTimeout
+	if body.Duration != "" {
+		duration, err := time.ParseDuration(body.Duration)
+		if err != nil || duration <= 0 {
+			writeJSON(writer, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid duration '%s'", body.Duration)})
+			return
+		}
+		revertAfter = duration
+	}
+
+	if err := l.setLevel(body.Module, body.Level, revertAfter); err != nil {
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Infof("user %s changed log level of module %s to %s for %s %v", user.UserName, body.Module, body.Level, revertAfter, requestLogFields(req))
+	audit(req, auditEventAdminAction, auditOutcomeSuccess, fmt.Sprintf("set log level of module %s to %s for %s", body.Module, body.Level, revertAfter))
+	writeJSON(writer, http.StatusOK, l.levels())
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/cloudogu/sonarcarp/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type levelSetterStub struct {
+	module, level string
+	revertAfter   time.Duration
+}
+
+func (l *levelSetterStub) set(module string, level string, revertAfter time.Duration) error {
+	l.module, l.level, l.revertAfter = module, level, revertAfter
+	return nil
+}
+
+func createLogLevelHandler(t *testing.T, user *internal.User) (logLevelHandler, *levelSetterStub) {
+	t.Helper()
+
+	handler, err := newLogLevelHandler("http://localhost:8080/sonar/", "cesAdmin", 0)
+	require.NoError(t, err)
+
+	setter := &levelSetterStub{}
+	handler.setLevel = setter.set
+	handler.levels = func() map[string]string { return map[string]string{"cas": "DEBUG"} }
+	handler.currentUser = func(*http.Request) (internal.User, bool) {
+		if user == nil {
+			return internal.User{}, false
+		}
+		return *user, true
+	}
+
+	return handler, setter
+}
+
+func newLogLevelRequest(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "/sonar/carp/log-level", strings.NewReader(body))
+	req.Header.Set("Origin", "http://localhost:8080")
+	return req
+}
+
+func TestLogLevelHandler_Middleware(t *testing.T) {
+	admin := &internal.User{UserName: "admin", Attributes: internal.UserAttributes{"groups": {"cesAdmin"}}}
+	developer := &internal.User{UserName: "dev", Attributes: internal.UserAttributes{"groups": {"developers"}}}
+
+	t.Run("forward other requests", func(t *testing.T) {
+		next := &mocks.Handler{}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		handler, _ := createLogLevelHandler(t, admin)
+
+		handler.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertExpectations(t)
+	})
+
+	t.Run("forward unauthenticated request to trigger the login", func(t *testing.T) {
+		next := &mocks.Handler{}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		handler, _ := createLogLevelHandler(t, nil)
+
+		handler.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/carp/log-level", nil))
+
+		next.AssertExpectations(t)
+	})
+
+	t.Run("deny non-admins", func(t *testing.T) {
+		handler, setter := createLogLevelHandler(t, developer)
+		recorder := httptest.NewRecorder()
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, newLogLevelRequest(http.MethodPut, `{"module":"cas","level":"DEBUG"}`))
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Empty(t, setter.module)
+	})
+
+	t.Run("read log levels", func(t *testing.T) {
+		handler, _ := createLogLevelHandler(t, admin)
+		recorder := httptest.NewRecorder()
+
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/carp/log-level", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"cas":"DEBUG"}`, recorder.Body.String())
+	})
+
+	t.Run("set log level with default reset timeout", func(t *testing.T) {
+		handler, setter := createLogLevelHandler(t, admin)
+		recorder := httptest.NewRecorder()
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, newLogLevelRequest(http.MethodPut, `{"module":"cas","level":"DEBUG"}`))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "cas", setter.module)
+		assert.Equal(t, "DEBUG", setter.level)
+		assert.Equal(t, defaultLogLevelResetTimeout, setter.revertAfter)
+	})
+
+	t.Run("set log level with custom duration", func(t *testing.T) {
+		handler, setter := createLogLevelHandler(t, admin)
+		recorder := httptest.NewRecorder()
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, newLogLevelRequest(http.MethodPost, `{"module":"proxy","level":"INFO","duration":"5m"}`))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, 5*time.Minute, setter.revertAfter)
+	})
+
+	t.Run("reject invalid duration", func(t *testing.T) {
+		handler, setter := createLogLevelHandler(t, admin)
+		recorder := httptest.NewRecorder()
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, newLogLevelRequest(http.MethodPut, `{"module":"proxy","level":"INFO","duration":"forever"}`))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Empty(t, setter.module)
+	})
+
+	t.Run("reject change from foreign origin", func(t *testing.T) {
+		handler, setter := createLogLevelHandler(t, admin)
+		recorder := httptest.NewRecorder()
+		req := newLogLevelRequest(http.MethodPost, `{"module":"cas","level":"DEBUG"}`)
+		req.Header.Set("Origin", "https://evil.example.com")
+
+		handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Empty(t, setter.module)
+	})
+}
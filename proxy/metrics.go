@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// runtimeVars are published by the expvar package itself. They reveal the command line and memory statistics of carp
+// and are no carp metrics.
+var runtimeVars = []string{"cmdline", "memstats"}
+
+// NewMetricsServer creates the server which exposes carp's metrics on the separate metrics-address. It returns nil if
+// no metrics address is configured.
+func NewMetricsServer(configuration config.Configuration) *http.Server {
+	if configuration.MetricsAddress == "" {
+		return nil
+	}
+
+	metricsPath := configuration.MetricsPath
+	if metricsPath == "" {
+		metricsPath = defaultMetricsPath
+	}
+
+	router := http.NewServeMux()
+	router.Handle(metricsPath, metricsHandler())
+
+	server := &http.Server{
+		Addr:    configuration.MetricsAddress,
+		Handler: router,
+	}
+	applyServerLimits(server, configuration)
+
+	return server
+}
+
+// metricsHandler writes all expvar variables except the runtime ones as JSON object like expvar.Handler.
+func metricsHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		_, _ = fmt.Fprintf(writer, "{\n")
+		first := true
+		expvar.Do(func(kv expvar.KeyValue) {
+			if slices.Contains(runtimeVars, kv.Key) {
+				return
+			}
+
+			if !first {
+				_, _ = fmt.Fprintf(writer, ",\n")
+			}
+			first = false
+			_, _ = fmt.Fprintf(writer, "%q: %s", kv.Key, kv.Value)
+		})
+		_, _ = fmt.Fprintf(writer, "\n}\n")
+	})
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetricsServer(t *testing.T) {
+	t.Run("disabled without metrics address", func(t *testing.T) {
+		assert.Nil(t, NewMetricsServer(config.Configuration{MetricsPath: "/metrics"}))
+	})
+
+	t.Run("serve carp metrics without runtime vars", func(t *testing.T) {
+		server := NewMetricsServer(config.Configuration{MetricsAddress: "127.0.0.1:9100"})
+		require.NotNil(t, server)
+		assert.Equal(t, "127.0.0.1:9100", server.Addr)
+
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		metrics := map[string]any{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &metrics))
+		assert.Contains(t, metrics, "cas_validation_requests_total")
+		assert.NotContains(t, metrics, "cmdline")
+		assert.NotContains(t, metrics, "memstats")
+	})
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const (
+	sonarMigrateDbApiPath        = "api/system/migrate_db"
+	sonarMigrationStatusApiPath  = "api/system/db_migration_status"
+	carpMigrationPathSuffix      = "carp/db-migration"
+	migrationUpstreamTimeout     = 30 * time.Second
+	migrationPageName            = "migration.html"
+	maintenancePageRetryAfterSec = "30"
+)
+
+type maintenancePageServer interface {
+	ServeMaintenance(writer http.ResponseWriter, req *http.Request)
+}
+
+type migrationPageData struct {
+	pageData
+	MigrationURL string
+}
+
+// migrationHandler guides CES administrators through SonarQube's database migration after an upgrade. All other
+// users get a maintenance page until the migration is done.
+type migrationHandler struct {
+	status        statusProvider
+	pages         maintenancePageServer
+	client        *http.Client
+	adminGroup    string
+	migrationPath string
+	baseURL       string
+	origin        *url.URL
+	migrateURL    string
+	statusURL     string
+	renderer      pageRenderer
+	currentUser   func(r *http.Request) (internal.User, bool)
+}
+
+func newMigrationHandler(serviceURL string, baseURL string, adminGroup string, status statusProvider, pages maintenancePageServer, renderer pageRenderer, transport http.RoundTripper) (migrationHandler, error) {
+	migrateURL, err := internal.SonarApiURL(serviceURL, baseURL, sonarMigrateDbApiPath)
+	if err != nil {
+		return migrationHandler{}, fmt.Errorf("could not create migration url: %w", err)
+	}
+
+	statusURL, err := internal.SonarApiURL(serviceURL, baseURL, sonarMigrationStatusApiPath)
+	if err != nil {
+		return migrationHandler{}, fmt.Errorf("could not create migration status url: %w", err)
+	}
+
+	migrationPath, err := carpPath(baseURL, carpMigrationPathSuffix)
+	if err != nil {
+		return migrationHandler{}, err
+	}
+
+	origin, err := url.Parse(baseURL)
+	if err != nil {
+		return migrationHandler{}, fmt.Errorf("could not parse base url '%s': %w", baseURL, err)
+	}
+
+	return migrationHandler{
+		status:        status,
+		pages:         pages,
+		client:        &http.Client{Transport: transport, Timeout: migrationUpstreamTimeout},
+		adminGroup:    adminGroup,
+		migrationPath: migrationPath,
+		baseURL:       baseURL,
+		origin:        origin,
+		migrateURL:    migrateURL,
+		statusURL:     statusURL,
+		renderer:      renderer,
+		currentUser:   casUser,
+	}, nil
+}
+
+// Middleware intercepts requests while SonarQube waits for its database migration.
+func (m migrationHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		isMigrationRequest := req.URL.Path == m.migrationPath
+		if m.status.Status() != statusDbMigrationNeeded && !isMigrationRequest {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		user, authenticated := m.currentUser(req)
+		if !authenticated {
+			// let the proxy handler redirect to the CAS login first
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		if !isMemberOf(user, m.adminGroup) {
+			if isMigrationRequest {
+				audit(req, auditEventAccessDenied, auditOutcomeFailure, "database migration requires admin group")
+			}
+			m.serveMaintenance(writer, req)
+			return
+		}
+
+		if isMigrationRequest {
+			m.serveMigrationApi(writer, req, user)
+			return
+		}
+
+		if isAPIRequest(req) {
+			writeStatusJSON(writer, statusDbMigrationNeeded, "SonarQube needs a database migration")
+			return
+		}
+
+		m.serveMigrationPage(writer, req)
+	})
+}
+
+func (m migrationHandler) serveMaintenance(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Retry-After", maintenancePageRetryAfterSec)
+
+	if isAPIRequest(req) {
+		writeStatusJSON(writer, statusDbMigrationNeeded, "SonarQube is under maintenance")
+		return
+	}
+
+	m.pages.ServeMaintenance(writer, req)
+}
+
+func (m migrationHandler) serveMigrationPage(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+
+	err := m.renderer.render(writer, migrationPageName, migrationPageData{pageData: m.renderer.pageData(req), MigrationURL: m.migrationPath})
+	if err != nil {
+		log.Errorf("failed to render migration page: %s %v", err.Error(), requestLogFields(req))
+	}
+}
+
+// serveMigrationApi starts the migration on POST requests and reports the migration state on GET requests.
+func (m migrationHandler) serveMigrationApi(writer http.ResponseWriter, req *http.Request, user internal.User) {
+	switch req.Method {
+	case http.MethodPost:
+		// the migration must not be triggered by forged requests of foreign pages an admin visits
+		if !isSameOrigin(req, m.origin) {
+			log.Warningf("reject database migration request of user %s from foreign origin '%s' %v", user.UserName, req.Header.Get("Origin"), requestLogFields(req))
+			audit(req, auditEventAccessDenied, auditOutcomeFailure, "database migration request from foreign origin")
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		log.Infof("database migration triggered by user %s %v", user.UserName, requestLogFields(req))
+		audit(req, auditEventAdminAction, auditOutcomeSuccess, "database migration triggered")
+		m.forwardToSonar(writer, req, http.MethodPost, m.migrateURL)
+	case http.MethodGet:
+		m.forwardToSonar(writer, req, http.MethodGet, m.statusURL)
+	default:
+		writer.Header().Set("Allow", "GET, POST")
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (m migrationHandler) forwardToSonar(writer http.ResponseWriter, req *http.Request, method string, target string) {
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), method, target, nil)
+	if err != nil {
+		log.Errorf("could not create migration request: %s %v", err.Error(), requestLogFields(req))
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := m.client.Do(upstreamReq)
+	if err != nil {
+		log.Errorf("could not call %s: %s %v", target, err.Error(), requestLogFields(req))
+		writer.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	writer.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	writer.WriteHeader(resp.StatusCode)
+
+	if _, err = io.Copy(writer, resp.Body); err != nil {
+		log.Errorf("could not copy migration response: %s %v", err.Error(), requestLogFields(req))
+	}
+}
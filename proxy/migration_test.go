@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/cloudogu/sonarcarp/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type maintenancePageStub struct {
+	called bool
+}
+
+func (m *maintenancePageStub) ServeMaintenance(writer http.ResponseWriter, _ *http.Request) {
+	m.called = true
+	writer.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func createMigrationHandler(t *testing.T, serviceURL string, status sonarStatus, user *internal.User) (migrationHandler, *maintenancePageStub) {
+	t.Helper()
+
+	pages := &maintenancePageStub{}
+	handler, err := newMigrationHandler(serviceURL, "http://localhost:8080/sonar/", "cesAdmin", fixedStatus(status), pages, createPageRenderer(t, "", user), http.DefaultTransport)
+	require.NoError(t, err)
+
+	handler.currentUser = func(*http.Request) (internal.User, bool) {
+		if user == nil {
+			return internal.User{}, false
+		}
+		return *user, true
+	}
+
+	return handler, pages
+}
+
+func TestMigrationHandler_Middleware(t *testing.T) {
+	admin := &internal.User{UserName: "admin", Attributes: internal.UserAttributes{"groups": {"cesAdmin"}}}
+	developer := &internal.User{UserName: "dev", Attributes: internal.UserAttributes{"groups": {"developers"}}}
+
+	t.Run("forward request if no migration is needed", func(t *testing.T) {
+		next := &mocks.Handler{}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		handler, pages := createMigrationHandler(t, "http://localhost:9000/", statusUp, developer)
+
+		handler.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertExpectations(t)
+		assert.False(t, pages.called)
+	})
+
+	t.Run("forward unauthenticated request to trigger the login", func(t *testing.T) {
+		next := &mocks.Handler{}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		handler, pages := createMigrationHandler(t, "http://localhost:9000/", statusDbMigrationNeeded, nil)
+
+		handler.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertExpectations(t)
+		assert.False(t, pages.called)
+	})
+
+	t.Run("serve maintenance page to non-admins", func(t *testing.T) {
+		next := &mocks.Handler{}
+		handler, pages := createMigrationHandler(t, "http://localhost:9000/", statusDbMigrationNeeded, developer)
+		recorder := httptest.NewRecorder()
+
+		handler.Middleware(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.True(t, pages.called)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	})
+
+	t.Run("serve migration page to admins", func(t *testing.T) {
+		next := &mocks.Handler{}
+		handler, pages := createMigrationHandler(t, "http://localhost:9000/", statusDbMigrationNeeded, admin)
+		recorder := httptest.NewRecorder()
+
+		handler.Middleware(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.False(t, pages.called)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"\/sonar\/carp\/db-migration"`)
+	})
+
+	t.Run("deny migration endpoint for non-admins", func(t *testing.T) {
+		next := &mocks.Handler{}
+		handler, pages := createMigrationHandler(t, "http://localhost:9000/", statusUp, developer)
+
+		handler.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/sonar/carp/db-migration", nil))
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.True(t, pages.called)
+	})
+
+	t.Run("trigger migration for admins", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/sonar/api/system/migrate_db", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"state":"MIGRATION_RUNNING","message":"Database migration is running."}`))
+		}))
+		defer sonar.Close()
+
+		next := &mocks.Handler{}
+		handler, _ := createMigrationHandler(t, sonar.URL, statusDbMigrationNeeded, admin)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/sonar/carp/db-migration", nil)
+		req.Header.Set("Origin", "http://localhost:8080")
+
+		handler.Middleware(next).ServeHTTP(recorder, req)
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"state":"MIGRATION_RUNNING","message":"Database migration is running."}`, recorder.Body.String())
+	})
+
+	t.Run("reject migration requests of foreign pages", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("migration must not be triggered")
+		}))
+		defer sonar.Close()
+
+		handler, _ := createMigrationHandler(t, sonar.URL, statusDbMigrationNeeded, admin)
+		for _, header := range []http.Header{
+			{"Origin": {"https://evil.example.com"}},
+			{"Origin": {"null"}},
+			{"Referer": {"https://evil.example.com/sonar/carp/db-migration"}},
+			{},
+		} {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/sonar/carp/db-migration", nil)
+			req.Header = header
+
+			handler.Middleware(&mocks.Handler{}).ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusForbidden, recorder.Code, header)
+		}
+	})
+
+	t.Run("report migration progress to admins", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, "/sonar/api/system/db_migration_status", r.URL.Path)
+			_, _ = w.Write([]byte(`{"state":"MIGRATION_SUCCEEDED"}`))
+		}))
+		defer sonar.Close()
+
+		next := &mocks.Handler{}
+		handler, _ := createMigrationHandler(t, sonar.URL, statusDbMigrationRunning, admin)
+		recorder := httptest.NewRecorder()
+
+		handler.Middleware(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/carp/db-migration", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"state":"MIGRATION_SUCCEEDED"}`, recorder.Body.String())
+	})
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+// pageNames are the templates carp renders. They are checked at startup so that broken overrides fail early.
+var pageNames = []string{"401.html", "starting.html", "maintenance.html", "error.html", "migration.html"}
+
+// pageData is available in all page templates.
+type pageData struct {
+	UserName  string
+	Groups    []string
+	RequestID string
+	LogoutURL string
+	BaseURL   string
+}
+
+// pageRenderer renders carp's pages as html templates. Files of the resource dir override the embedded files.
+type pageRenderer struct {
+	files       fs.FS
+	baseURL     string
+	logoutURL   func() string
+	currentUser func(r *http.Request) (internal.User, bool)
+}
+
+func newPageRenderer(resourceDir string, baseURL string, logoutURL func() string) (pageRenderer, error) {
+	files, err := fs.Sub(content, "public")
+	if err != nil {
+		return pageRenderer{}, fmt.Errorf("could not read subdir public: %w", err)
+	}
+
+	if resourceDir != "" {
+		info, err := os.Stat(resourceDir)
+		if err != nil {
+			return pageRenderer{}, fmt.Errorf("could not read carp-resource-dir: %w", err)
+		}
+		if !info.IsDir() {
+			return pageRenderer{}, fmt.Errorf("carp-resource-dir '%s' is no directory", resourceDir)
+		}
+
+		files = overlayFS{upper: os.DirFS(resourceDir), lower: files}
+	}
+
+	renderer := pageRenderer{files: files, baseURL: baseURL, logoutURL: logoutURL, currentUser: casUser}
+	for _, name := range pageNames {
+		_, err = renderer.parse(files, name)
+		if err != nil {
+			return pageRenderer{}, err
+		}
+	}
+
+	return renderer, nil
+}
+
+func (p pageRenderer) pageData(r *http.Request) pageData {
+	data := pageData{RequestID: requestID(r), BaseURL: p.baseURL}
+	if p.logoutURL != nil {
+		data.LogoutURL = p.logoutURL()
+	}
+
+	if user, ok := p.currentUser(r); ok {
+		data.UserName = user.UserName
+		data.Groups = user.GetGroups()
+	}
+
+	return data
+}
+
+// render parses the template on every call so that changed files in the resource dir are used without a restart.
+func (p pageRenderer) render(writer io.Writer, name string, data any) error {
+	pageTemplate, err := p.parse(p.files, name)
+	if err != nil {
+		return err
+	}
+
+	return pageTemplate.Execute(writer, data)
+}
+
+func (p pageRenderer) parse(files fs.FS, name string) (*template.Template, error) {
+	pageTemplate, err := template.ParseFS(files, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse page template %s: %w", name, err)
+	}
+
+	return pageTemplate, nil
+}
+
+// ServePage renders a page of fsys with the common page data. It is the serveFileFunc of the static handler.
+func (p pageRenderer) ServePage(writer http.ResponseWriter, req *http.Request, fsys fs.FS, name string) {
+	pageTemplate, err := p.parse(fsys, name)
+	if err == nil {
+		err = pageTemplate.Execute(writer, p.pageData(req))
+	}
+
+	if err != nil {
+		log.Errorf("failed to render page %s: %s %v", name, err.Error(), requestLogFields(req))
+	}
+}
+
+// overlayFS opens files from upper and falls back to lower if they do not exist there.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.upper.Open(name)
+	if err == nil {
+		return file, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return o.lower.Open(name)
+}
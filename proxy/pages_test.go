@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPageRenderer(t *testing.T, resourceDir string, user *internal.User) pageRenderer {
+	t.Helper()
+
+	renderer, err := newPageRenderer(resourceDir, "https://ces.example.com/sonar/", func() string {
+		return "https://ces.example.com/cas/logout"
+	})
+	require.NoError(t, err)
+
+	renderer.currentUser = func(*http.Request) (internal.User, bool) {
+		if user == nil {
+			return internal.User{}, false
+		}
+		return *user, true
+	}
+
+	return renderer
+}
+
+func TestPageRenderer(t *testing.T) {
+	user := &internal.User{UserName: "tricia", Attributes: internal.UserAttributes{"groups": {"developers", "testers"}}}
+
+	t.Run("override page with template of resource dir", func(t *testing.T) {
+		resourceDir := t.TempDir()
+		page := `{{.UserName}}|{{range .Groups}}{{.}},{{end}}|{{.RequestID}}|{{.LogoutURL}}|{{.BaseURL}}`
+		require.NoError(t, os.WriteFile(filepath.Join(resourceDir, "401.html"), []byte(page), 0600))
+		handler := createStaticFileHandler(createPageRenderer(t, resourceDir, user))
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/sonar/", nil)
+
+		handler.ServeUnauthorized(recorder, req.WithContext(internal.WithRequestID(req.Context(), "req-1")))
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "tricia|developers,testers,|req-1|https://ces.example.com/cas/logout|https://ces.example.com/sonar/", recorder.Body.String())
+	})
+
+	t.Run("fall back to embedded pages", func(t *testing.T) {
+		handler := createStaticFileHandler(createPageRenderer(t, t.TempDir(), nil))
+		recorder := httptest.NewRecorder()
+
+		handler.ServeStarting(recorder, httptest.NewRequest(http.MethodGet, "/sonar/", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "SonarQube is starting")
+	})
+
+	t.Run("serve static files of resource dir", func(t *testing.T) {
+		resourceDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(resourceDir, "logo.svg"), []byte("<svg/>"), 0600))
+		handler := createStaticFileHandler(createPageRenderer(t, resourceDir, nil))
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/public/logo.svg", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "<svg/>", recorder.Body.String())
+	})
+
+	t.Run("fail on broken template override", func(t *testing.T) {
+		resourceDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(resourceDir, "error.html"), []byte("{{.Title"), 0600))
+
+		_, err := newPageRenderer(resourceDir, "", nil)
+
+		assert.ErrorContains(t, err, "could not parse page template error.html")
+	})
+
+	t.Run("fail on missing resource dir", func(t *testing.T) {
+		_, err := newPageRenderer("/does/not/exist", "", nil)
+
+		assert.ErrorContains(t, err, "could not read carp-resource-dir")
+	})
+}
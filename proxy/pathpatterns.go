@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+// pathPatterns match requests by path and method. A path is either a path.Match pattern or a prefix ending with /**.
+// Without methods all methods match.
+type pathPatterns []config.PathPattern
+
+func (p pathPatterns) matches(r *http.Request) bool {
+	for _, pattern := range p {
+		if len(pattern.Methods) > 0 && !slices.ContainsFunc(pattern.Methods, func(method string) bool {
+			return strings.EqualFold(method, r.Method)
+		}) {
+			continue
+		}
+
+		if prefix, ok := strings.CutSuffix(pattern.Path, "/**"); ok {
+			if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+				return true
+			}
+			continue
+		}
+
+		if matched, _ := path.Match(pattern.Path, r.URL.Path); matched {
+			return true
+		}
+	}
+
+	return false
+}
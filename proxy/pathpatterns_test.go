@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathPatterns_matches(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/sonar/api/system/status", true},
+		{http.MethodPost, "/sonar/api/system/status", false},
+		{http.MethodGet, "/sonar/api/project_badges/measure", true},
+		{http.MethodGet, "/sonar/api/project_badges/measure/other", false},
+		{http.MethodPost, "/sonar/api/alm_integrations/webhook", true},
+		{http.MethodGet, "/sonar/js/out/app.js", true},
+		{http.MethodGet, "/sonar/json", false},
+		{http.MethodGet, "/sonar/api/projects/search", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, testAnonymousPaths.matches(httptest.NewRequest(tt.method, tt.path, nil)))
+		})
+	}
+}
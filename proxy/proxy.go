@@ -4,11 +4,19 @@ import (
 	"fmt"
 	"github.com/cloudogu/go-cas"
 	"github.com/vulcand/oxy/v2/forward"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+type middleware func(http.Handler) http.Handler
+
+// sonarLogoutApiPath is forwarded without authentication so that SonarQube can end its own session.
+const sonarLogoutApiPath = "/sonar/api/authentication/logout"
+
 type authorizationChecker interface {
 	IsAuthorized(r *http.Request) bool
 }
@@ -35,7 +43,7 @@ type proxyHandler struct {
 	logoutRedirectionPath string
 }
 
-func createProxyHandler(sTargetURL string, headers authorizationHeaders, casClient *cas.Client, logoutPath string, logoutRedirectionPath string) (http.Handler, error) {
+func createProxyHandler(sTargetURL string, headers authorizationHeaders, anonymous pathPatterns, casClient *cas.Client, transport http.RoundTripper, errorHandler func(http.ResponseWriter, *http.Request, error), logoutPath string, logoutRedirectionPath string, middlewares ...middleware) (http.Handler, error) {
 	log.Debugf("creating proxy middleware")
 
 	targetURL, err := url.Parse(sTargetURL)
@@ -44,6 +52,12 @@ func createProxyHandler(sTargetURL string, headers authorizationHeaders, casClie
 	}
 
 	fwd := forward.New(true)
+	if transport != nil {
+		fwd.Transport = transport
+	}
+	if errorHandler != nil {
+		fwd.ErrorHandler = errorHandler
+	}
 
 	pHandler := proxyHandler{
 		targetURL:             targetURL,
@@ -54,7 +68,14 @@ func createProxyHandler(sTargetURL string, headers authorizationHeaders, casClie
 		logoutRedirectionPath: logoutRedirectionPath,
 	}
 
-	return casClient.CreateHandler(pHandler), nil
+	var handler http.Handler = pHandler
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	casHandler := casSpanMiddleware(casValidations.Middleware(renewedTicketMiddleware(casClient.CreateHandler(auditAuthenticationMiddleware(endCasSpanMiddleware(handler))))))
+
+	return anonymousMiddleware(anonymous, pHandler.serveAnonymous)(casHandler), nil
 }
 
 func (p proxyHandler) isLogoutRequest(r *http.Request) bool {
@@ -64,25 +85,61 @@ func (p proxyHandler) isLogoutRequest(r *http.Request) bool {
 }
 
 func (p proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if p.isLogoutRequest(r) {
-		cas.RedirectToLogout(w, r)
+	if isAnonymousRequest(r) {
+		p.serveAnonymous(w, r)
 		return
 	}
 
-	if !cas.IsAuthenticated(r) && r.URL.Path != "/sonar/api/authentication/logout" {
-		cas.RedirectToLogin(w, r)
+	if p.redirectToCas(w, r) {
 		return
 	}
 
-	log.Debugf("proxy middleware called with request to %s and headers %+v", r.URL.String(), r.Header)
+	fields := requestLogFields(r)
+	log.Debugf("proxy middleware called with request to %s and headers %+v %v", r.URL, r.Header, fields)
 
-	log.Debug("Found authorized request: IP %s, XForwardedFor %s, URL %s", r.RemoteAddr, r.Header[forward.XForwardedFor], r.URL.String())
+	log.Debugf("Found authorized request: IP %s, XForwardedFor %s, URL %s %v", r.RemoteAddr, r.Header[forward.XForwardedFor], r.URL, fields)
+	_, authorizeSpan := tracer.Start(r.Context(), "carp.authorize", trace.WithAttributes(attribute.String("carp.principal", cas.Username(r))))
+	setHeaders(r, p.headers)
+	authorizeSpan.End()
+
+	p.forward(w, r)
+}
+
+func (p proxyHandler) forward(w http.ResponseWriter, r *http.Request) {
 	r.URL.Host = p.targetURL.Host     // copy target URL but not the URL path, only the host
 	r.URL.Scheme = p.targetURL.Scheme // (and scheme because they get lost on the way)
 
-	setHeaders(r, p.headers)
+	ctx, forwardSpan := tracer.Start(r.Context(), "upstream.forward", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.ServerAddress(p.targetURL.Hostname()),
+	))
+	defer forwardSpan.End()
+
+	injectTraceContext(ctx, r.Header)
+	p.forwarder.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// redirectToCas redirects logout requests and unauthenticated requests to CAS and reports whether it did.
+func (p proxyHandler) redirectToCas(w http.ResponseWriter, r *http.Request) bool {
+	_, span := tracer.Start(r.Context(), "cas.redirect-decision")
+	defer span.End()
+
+	if p.isLogoutRequest(r) {
+		span.SetAttributes(attribute.String("cas.redirect", "logout"))
+		casLog.Debugf("redirect logout request to CAS %v", requestLogFields(r))
+		audit(r, auditEventLogout, auditOutcomeSuccess, "")
+		cas.RedirectToLogout(w, r)
+		return true
+	}
+
+	if !cas.IsAuthenticated(r) && r.URL.Path != sonarLogoutApiPath {
+		span.SetAttributes(attribute.String("cas.redirect", "login"))
+		casLog.Debugf("redirect unauthenticated request to CAS login %v", requestLogFields(r))
+		cas.RedirectToLogin(w, r)
+		return true
+	}
 
-	p.forwarder.ServeHTTP(w, r)
+	span.SetAttributes(attribute.String("cas.redirect", "none"))
+	return false
 }
 
 func setHeaders(r *http.Request, headers authorizationHeaders) {
@@ -16,7 +16,7 @@ func TestCreateProxyHandler(t *testing.T) {
 	t.Run("create handler", func(t *testing.T) {
 		targetURL := "testURL"
 
-		handler, err := createProxyHandler(targetURL, authorizationHeaders{}, &cas.Client{}, "", "")
+		handler, err := createProxyHandler(targetURL, authorizationHeaders{}, nil, &cas.Client{}, nil, nil, "", "")
 
 		assert.NoError(t, err)
 		assert.NotNil(t, handler)
@@ -29,7 +29,7 @@ func TestCreateProxyHandler(t *testing.T) {
 
 		invalidTargetURL := ":example.com"
 
-		_, err := createProxyHandler(invalidTargetURL, authorizationHeaders{}, nil, "", "")
+		_, err := createProxyHandler(invalidTargetURL, authorizationHeaders{}, nil, nil, nil, nil, "", "")
 
 		middlewareMock1.AssertNotCalled(t, "Execute", mock.Anything)
 		middlewareMock2.AssertNotCalled(t, "Execute", mock.Anything)
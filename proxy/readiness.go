@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const (
+	defaultStatusPollInterval = 5 * time.Second
+	defaultStatusFailureLimit = 60
+	statusRequestTimeout      = 5 * time.Second
+	sonarStatusApiPath        = "api/system/status"
+)
+
+// sonarStatus is the status reported by SonarQube's api/system/status endpoint.
+type sonarStatus string
+
+const (
+	statusUnknown            sonarStatus = ""
+	statusStarting           sonarStatus = "STARTING"
+	statusUp                 sonarStatus = "UP"
+	statusDown               sonarStatus = "DOWN"
+	statusRestarting         sonarStatus = "RESTARTING"
+	statusDbMigrationNeeded  sonarStatus = "DB_MIGRATION_NEEDED"
+	statusDbMigrationRunning sonarStatus = "DB_MIGRATION_RUNNING"
+	// statusUnreachable is no SonarQube status. It is set when the status could not be fetched repeatedly, requests
+	// are then forwarded because a broken status endpoint must not block SonarQube.
+	statusUnreachable sonarStatus = "UNREACHABLE"
+)
+
+type statusResponse struct {
+	Status sonarStatus `json:"status"`
+}
+
+// statusPoller periodically asks SonarQube for its status and keeps the last known one.
+type statusPoller struct {
+	client       *http.Client
+	statusURL    string
+	interval     time.Duration
+	failureLimit int
+	failures     int
+
+	mu     sync.RWMutex
+	status sonarStatus
+}
+
+// newStatusPoller creates a poller for the status api below the context path of baseURL. After failureLimit failed
+// polls in a row the status becomes statusUnreachable.
+func newStatusPoller(serviceURL string, baseURL string, interval time.Duration, failureLimit int, transport http.RoundTripper) (*statusPoller, error) {
+	statusURL, err := internal.SonarApiURL(serviceURL, baseURL, sonarStatusApiPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create status url: %w", err)
+	}
+
+	if interval <= 0 {
+		interval = defaultStatusPollInterval
+	}
+	if failureLimit <= 0 {
+		failureLimit = defaultStatusFailureLimit
+	}
+
+	return &statusPoller{
+		client:       &http.Client{Transport: transport, Timeout: statusRequestTimeout},
+		statusURL:    statusURL,
+		interval:     interval,
+		failureLimit: failureLimit,
+	}, nil
+}
+
+// Status returns the last polled SonarQube status.
+func (p *statusPoller) Status() sonarStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.status
+}
+
+func (p *statusPoller) setStatus(status sonarStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.status != status {
+		log.Infof("SonarQube status changed from '%s' to '%s'", p.status, status)
+	}
+	p.status = status
+}
+
+// Run polls the status until the context is cancelled.
+func (p *statusPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *statusPoller) poll(ctx context.Context) {
+	status, err := p.fetchStatus(ctx)
+	if err != nil {
+		p.failures++
+		if p.failures < p.failureLimit {
+			log.Debugf("failed to fetch SonarQube status (%d/%d): %s", p.failures, p.failureLimit, err.Error())
+			p.setStatus(statusUnknown)
+			return
+		}
+
+		if p.failures == p.failureLimit {
+			log.Warningf("failed to fetch SonarQube status %d times, forward requests without readiness check: %s", p.failures, err.Error())
+		}
+		p.setStatus(statusUnreachable)
+		return
+	}
+
+	p.failures = 0
+	p.setStatus(status)
+}
+
+func (p *statusPoller) fetchStatus(ctx context.Context) (sonarStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.statusURL, nil)
+	if err != nil {
+		return statusUnknown, fmt.Errorf("could not create status request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return statusUnknown, fmt.Errorf("could not request status from %s: %w", p.statusURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusUnknown, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, p.statusURL)
+	}
+
+	var body statusResponse
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return statusUnknown, fmt.Errorf("could not decode status response: %w", err)
+	}
+
+	return body.Status, nil
+}
+
+type statusProvider interface {
+	Status() sonarStatus
+}
+
+type startingPageServer interface {
+	ServeStarting(writer http.ResponseWriter, req *http.Request)
+}
+
+// readinessMiddleware answers requests itself as long as SonarQube is not ready to serve them.
+func readinessMiddleware(next http.Handler, status statusProvider, pages startingPageServer, retryAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		current := status.Status()
+		if !isStarting(current) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		writer.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+
+		if isAPIRequest(req) {
+			writeStatusJSON(writer, current, "SonarQube is starting")
+			return
+		}
+
+		pages.ServeStarting(writer, req)
+	})
+}
+
+func isStarting(status sonarStatus) bool {
+	switch status {
+	case statusUnknown, statusStarting, statusRestarting, statusDbMigrationRunning:
+		return true
+	default:
+		return false
+	}
+}
+
+func writeStatusJSON(writer http.ResponseWriter, status sonarStatus, message string) {
+	if status == statusUnknown {
+		status = statusStarting
+	}
+
+	writeJSON(writer, http.StatusServiceUnavailable, map[string]string{
+		"status":  string(status),
+		"message": message,
+	})
+}
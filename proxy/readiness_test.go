@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedStatus sonarStatus
+
+func (f fixedStatus) Status() sonarStatus {
+	return sonarStatus(f)
+}
+
+type pageServerStub struct {
+	called bool
+}
+
+func (p *pageServerStub) ServeStarting(writer http.ResponseWriter, _ *http.Request) {
+	p.called = true
+	writer.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func TestStatusPoller_poll(t *testing.T) {
+	t.Run("reads status from sonarqube", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/sonar/api/system/status", r.URL.Path)
+			_, _ = w.Write([]byte(`{"id":"1","version":"25.1","status":"UP"}`))
+		}))
+		defer sonar.Close()
+
+		poller, err := newStatusPoller(sonar.URL+"/", "https://ces.example.com/sonar/", time.Second, 0, http.DefaultTransport)
+		require.NoError(t, err)
+
+		poller.poll(context.Background())
+
+		assert.Equal(t, statusUp, poller.Status())
+	})
+
+	t.Run("unknown status if sonarqube is not reachable", func(t *testing.T) {
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer sonar.Close()
+
+		poller, err := newStatusPoller(sonar.URL, "https://ces.example.com/sonar/", 0, 0, http.DefaultTransport)
+		require.NoError(t, err)
+		poller.status = statusUp
+
+		poller.poll(context.Background())
+
+		assert.Equal(t, statusUnknown, poller.Status())
+		assert.Equal(t, defaultStatusPollInterval, poller.interval)
+		assert.Equal(t, defaultStatusFailureLimit, poller.failureLimit)
+	})
+
+	t.Run("unreachable status after failure limit", func(t *testing.T) {
+		up := false
+		sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !up {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"STARTING"}`))
+		}))
+		defer sonar.Close()
+
+		poller, err := newStatusPoller(sonar.URL, "https://ces.example.com/sonar/", time.Second, 3, http.DefaultTransport)
+		require.NoError(t, err)
+
+		poller.poll(context.Background())
+		poller.poll(context.Background())
+		assert.Equal(t, statusUnknown, poller.Status())
+
+		poller.poll(context.Background())
+		poller.poll(context.Background())
+		assert.Equal(t, statusUnreachable, poller.Status())
+		assert.False(t, isStarting(poller.Status()))
+
+		up = true
+		poller.poll(context.Background())
+		assert.Equal(t, statusStarting, poller.Status())
+		assert.Equal(t, 0, poller.failures)
+	})
+}
+
+func TestReadinessMiddleware(t *testing.T) {
+	t.Run("forward request if sonarqube is up", func(t *testing.T) {
+		next := &mocks.Handler{}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		pages := &pageServerStub{}
+
+		handler := readinessMiddleware(next, fixedStatus(statusUp), pages, 5*time.Second)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertExpectations(t)
+		assert.False(t, pages.called)
+	})
+
+	t.Run("serve starting page to browsers", func(t *testing.T) {
+		next := &mocks.Handler{}
+		pages := &pageServerStub{}
+		recorder := httptest.NewRecorder()
+
+		handler := readinessMiddleware(next, fixedStatus(statusStarting), pages, 5*time.Second)
+
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.True(t, pages.called)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, "5", recorder.Header().Get("Retry-After"))
+	})
+
+	t.Run("serve json to api clients", func(t *testing.T) {
+		next := &mocks.Handler{}
+		pages := &pageServerStub{}
+		recorder := httptest.NewRecorder()
+
+		handler := readinessMiddleware(next, fixedStatus(statusDbMigrationRunning), pages, 5*time.Second)
+
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/api/issues/search", nil))
+
+		next.AssertNotCalled(t, "ServeHTTP")
+		assert.False(t, pages.called)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"status":"DB_MIGRATION_RUNNING","message":"SonarQube is starting"}`, recorder.Body.String())
+	})
+}
@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudogu/go-cas"
+)
+
+const (
+	defaultReauthMaxAge         = 15 * time.Minute
+	casSessionCookieName        = "_cas_session"
+	authenticationDateAttribute = "authenticationDate"
+	// casSessionLifetime is the max age of the go-cas session cookie.
+	casSessionLifetime = 24 * time.Hour
+	// reauthParameter marks the service url of a renewed login, so that its ticket is validated with renew=true.
+	reauthParameter = "carp-reauth"
+)
+
+// reauthentication forces a new CAS login with renew=true on sensitive paths if the last authentication of the user
+// is older than maxAge.
+type reauthentication struct {
+	paths              pathPatterns
+	maxAge             time.Duration
+	baseURL            *url.URL
+	loginURL           func(r *http.Request) (string, error)
+	serviceLoginURL    func(service string) (string, error)
+	now                func() time.Time
+	isAuthenticated    func(r *http.Request) bool
+	authenticationTime func(r *http.Request) (time.Time, bool)
+	isNewTicket        func(r *http.Request) bool
+	sessions           *sessionStarts
+	missingDateWarning *sync.Once
+}
+
+// newReauthentication creates the re-authentication for paths. loginURL creates the login url leading back to the
+// request, serviceLoginURL the one leading back to another service url of SonarQube below baseURL.
+func newReauthentication(paths pathPatterns, maxAge time.Duration, baseURL string, loginURL func(r *http.Request) (string, error), serviceLoginURL func(service string) (string, error)) (reauthentication, error) {
+	parsedBaseURL, err := url.Parse(baseURL)
+	if err != nil {
+		return reauthentication{}, fmt.Errorf("could not parse base url '%s': %w", baseURL, err)
+	}
+
+	return reauthentication{
+		paths:              paths,
+		maxAge:             durationOrDefault(maxAge, defaultReauthMaxAge),
+		baseURL:            parsedBaseURL,
+		loginURL:           loginURL,
+		serviceLoginURL:    serviceLoginURL,
+		now:                time.Now,
+		isAuthenticated:    cas.IsAuthenticated,
+		authenticationTime: authenticationTime,
+		isNewTicket:        cas.IsFirstAuthenticatedRequest,
+		sessions:           &sessionStarts{starts: map[string]time.Time{}},
+		missingDateWarning: &sync.Once{},
+	}, nil
+}
+
+func (a reauthentication) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if !a.isAuthenticated(req) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		if a.isNewTicket(req) && req.URL.Query().Has(reauthParameter) {
+			a.sessions.record(casSession(req), a.now())
+		}
+
+		if !a.paths.matches(req) || a.isFresh(req) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		loginURL, err := a.renewURL(req)
+		if err != nil {
+			casLog.Errorf("failed to create CAS renew url: %s %v", err.Error(), requestLogFields(req))
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		casLog.Infof("require re-authentication for %s %v", req.URL.Path, requestLogFields(req))
+		audit(req, auditEventReauthentication, auditOutcomeFailure, "authentication is older than "+a.maxAge.String())
+
+		if isAPIRequest(req) {
+			writer.Header().Set("WWW-Authenticate", `CAS login-url="`+loginURL+`"`)
+			writeJSON(writer, http.StatusUnauthorized, map[string]any{
+				"status":    http.StatusUnauthorized,
+				"error":     "reauthentication-required",
+				"message":   "This action requires a recent login, log in again at loginUrl",
+				"loginUrl":  loginURL,
+				"requestId": requestID(req),
+			})
+			return
+		}
+
+		http.Redirect(writer, req, loginURL, http.StatusFound)
+	})
+}
+
+// isFresh reports whether the user authenticated within maxAge, either by a login renewed by carp or according to the
+// authentication date released by CAS. Without both the authentication counts as stale.
+func (a reauthentication) isFresh(req *http.Request) bool {
+	now := a.now()
+	if renewed, ok := a.sessions.start(casSession(req)); ok && now.Sub(renewed) <= a.maxAge {
+		return true
+	}
+
+	authenticationDate, ok := a.authenticationTime(req)
+	if !ok {
+		a.missingDateWarning.Do(func() {
+			casLog.Warningf("CAS does not release the %s attribute, only logins renewed by carp count as recent", authenticationDateAttribute)
+		})
+		return false
+	}
+
+	return now.Sub(authenticationDate) <= a.maxAge
+}
+
+// renewURL returns the CAS login url with renew=true whose service url is marked with reauthParameter. CAS redirects
+// back with GET, so API and form requests return to the page they were sent from instead of the request url.
+func (a reauthentication) renewURL(req *http.Request) (string, error) {
+	var loginURL string
+	var err error
+	if req.Method == http.MethodGet && !isAPIRequest(req) {
+		loginURL, err = a.loginURL(req)
+	} else {
+		loginURL, err = a.serviceLoginURL(a.returnURL(req))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	renewURL, err := url.Parse(loginURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := renewURL.Query()
+	service, err := url.Parse(query.Get("service"))
+	if err != nil {
+		return "", err
+	}
+
+	serviceQuery := service.Query()
+	serviceQuery.Set(reauthParameter, "true")
+	service.RawQuery = serviceQuery.Encode()
+
+	query.Set("service", service.String())
+	query.Set("renew", "true")
+	renewURL.RawQuery = query.Encode()
+
+	return renewURL.String(), nil
+}
+
+// returnURL returns the Referer if it is a page of SonarQube, otherwise the base url.
+func (a reauthentication) returnURL(req *http.Request) string {
+	referer, err := url.Parse(req.Header.Get("Referer"))
+	if err != nil || !strings.EqualFold(referer.Scheme, a.baseURL.Scheme) || !strings.EqualFold(referer.Host, a.baseURL.Host) ||
+		!strings.HasPrefix(referer.Path, a.baseURL.Path) {
+		return a.baseURL.String()
+	}
+
+	return referer.String()
+}
+
+// sessionStarts remembers when carp created the CAS sessions, i.e. when their service ticket was validated.
+type sessionStarts struct {
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+func (s *sessionStarts) record(session string, start time.Time) {
+	if session == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for expiredSession, expiredStart := range s.starts {
+		if start.Sub(expiredStart) > casSessionLifetime {
+			delete(s.starts, expiredSession)
+		}
+	}
+	s.starts[session] = start
+}
+
+func (s *sessionStarts) start(session string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start, ok := s.starts[session]
+	return start, ok
+}
+
+// renewedTicketMiddleware lets go-cas validate the ticket of a renewed login. go-cas prefers an existing session over a
+// new ticket, so the session cookie is dropped from such requests and go-cas creates a new session for the ticket.
+func renewedTicketMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if query.Has(reauthParameter) && query.Get("ticket") != "" {
+			dropCookie(req, casSessionCookieName)
+		}
+
+		next.ServeHTTP(writer, req)
+	})
+}
+
+func dropCookie(req *http.Request, name string) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			req.AddCookie(cookie)
+		}
+	}
+}
+
+// renewValidationTransport validates tickets of renewed logins with renew=true. CAS then rejects tickets which were
+// issued from an existing SSO session instead of a login with credentials.
+type renewValidationTransport struct {
+	next http.RoundTripper
+}
+
+func (t renewValidationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service, err := url.Parse(req.URL.Query().Get("service"))
+	if err != nil || !service.Query().Has(reauthParameter) {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	query.Set("renew", "true")
+	req.URL.RawQuery = query.Encode()
+
+	return t.next.RoundTrip(req)
+}
+
+// casSession returns the id of the go-cas session. go-cas adds the cookie to the request when it creates the session.
+func casSession(req *http.Request) string {
+	cookie, err := req.Cookie(casSessionCookieName)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// authenticationTime reads the authenticationDate of the CAS response. CAS releases it either as protocol attribute or
+// as user attribute, the latter may carry a java zone id like 2025-01-02T10:00:00.123+01:00[Europe/Berlin].
+func authenticationTime(req *http.Request) (time.Time, bool) {
+	if authenticationDate := cas.AuthenticationDate(req); !authenticationDate.IsZero() {
+		return authenticationDate, true
+	}
+
+	return parseAuthenticationDate(cas.Attributes(req).Get(authenticationDateAttribute))
+}
+
+func parseAuthenticationDate(value string) (time.Time, bool) {
+	if zoneStart := strings.Index(value, "["); zoneStart > 0 {
+		value = value[:zoneStart]
+	}
+
+	authenticationDate, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return authenticationDate, true
+}
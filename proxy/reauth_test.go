@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+
+func createReauthentication(t *testing.T, authenticationDate time.Time) reauthentication {
+	t.Helper()
+
+	paths := pathPatterns{
+		{Path: "/sonar/admin/**"},
+		{Path: "/sonar/api/permissions/*", Methods: []string{http.MethodPost}},
+	}
+	loginURL := func(r *http.Request) (string, error) {
+		return "https://ces.example.com/cas/login?service=https%3A%2F%2Fces.example.com" + r.URL.Path, nil
+	}
+	serviceLoginURL := func(service string) (string, error) {
+		return "https://ces.example.com/cas/login?service=" + url.QueryEscape(service), nil
+	}
+
+	reauth, err := newReauthentication(paths, 0, "https://ces.example.com/sonar/", loginURL, serviceLoginURL)
+	require.NoError(t, err)
+	reauth.now = func() time.Time { return testNow }
+	reauth.isAuthenticated = func(*http.Request) bool { return true }
+	reauth.authenticationTime = func(*http.Request) (time.Time, bool) {
+		return authenticationDate, !authenticationDate.IsZero()
+	}
+	reauth.isNewTicket = func(*http.Request) bool { return false }
+
+	return reauth
+}
+
+func TestReauthentication_Middleware(t *testing.T) {
+	var called bool
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })
+	serve := func(reauth reauthentication, req *http.Request) *httptest.ResponseRecorder {
+		called = false
+		recorder := httptest.NewRecorder()
+		reauth.Middleware(next).ServeHTTP(recorder, req)
+		return recorder
+	}
+	stale := testNow.Add(-time.Hour)
+
+	t.Run("renew stale authentication on sensitive page", func(t *testing.T) {
+		recorder := serve(createReauthentication(t, stale), httptest.NewRequest(http.MethodGet, "/sonar/admin/users", nil))
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, "https://ces.example.com/cas/login?renew=true&service=https%3A%2F%2Fces.example.com%2Fsonar%2Fadmin%2Fusers%3Fcarp-reauth%3Dtrue", recorder.Header().Get("Location"))
+		assert.Empty(t, recorder.Result().Cookies())
+	})
+
+	t.Run("answer stale API request with 401", func(t *testing.T) {
+		recorder := serve(createReauthentication(t, stale), httptest.NewRequest(http.MethodPost, "/sonar/api/permissions/add_user", nil))
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "renew=true")
+		assert.Empty(t, recorder.Result().Cookies())
+		body := map[string]any{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "reauthentication-required", body["error"])
+		assert.Equal(t, "https://ces.example.com/cas/login?renew=true&service=https%3A%2F%2Fces.example.com%2Fsonar%2F%3Fcarp-reauth%3Dtrue", body["loginUrl"])
+	})
+
+	t.Run("return API request to same-origin referer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/sonar/api/permissions/add_user", nil)
+		req.Header.Set("Referer", "https://ces.example.com/sonar/admin/permissions")
+
+		recorder := serve(createReauthentication(t, stale), req)
+
+		body := map[string]any{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "https://ces.example.com/cas/login?renew=true&service=https%3A%2F%2Fces.example.com%2Fsonar%2Fadmin%2Fpermissions%3Fcarp-reauth%3Dtrue", body["loginUrl"])
+	})
+
+	t.Run("ignore foreign referer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/sonar/api/permissions/add_user", nil)
+		req.Header.Set("Referer", "https://evil.example.com/sonar/admin/permissions")
+
+		recorder := serve(createReauthentication(t, stale), req)
+
+		body := map[string]any{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "https://ces.example.com/cas/login?renew=true&service=https%3A%2F%2Fces.example.com%2Fsonar%2F%3Fcarp-reauth%3Dtrue", body["loginUrl"])
+	})
+
+	t.Run("pass fresh authentication", func(t *testing.T) {
+		serve(createReauthentication(t, testNow.Add(-time.Minute)), httptest.NewRequest(http.MethodGet, "/sonar/admin/users", nil))
+
+		assert.True(t, called)
+	})
+
+	t.Run("pass stale authentication on other paths", func(t *testing.T) {
+		serve(createReauthentication(t, stale), httptest.NewRequest(http.MethodGet, "/sonar/projects", nil))
+		assert.True(t, called)
+
+		serve(createReauthentication(t, stale), httptest.NewRequest(http.MethodGet, "/sonar/api/permissions/users", nil))
+		assert.True(t, called)
+	})
+
+	t.Run("pass unauthenticated request", func(t *testing.T) {
+		reauth := createReauthentication(t, stale)
+		reauth.isAuthenticated = func(*http.Request) bool { return false }
+
+		serve(reauth, httptest.NewRequest(http.MethodGet, "/sonar/admin/users", nil))
+
+		assert.True(t, called)
+	})
+
+	sessionRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: casSessionCookieName, Value: "session-1"})
+		return req
+	}
+
+	t.Run("without authentication date require renewed login", func(t *testing.T) {
+		reauth := createReauthentication(t, time.Time{})
+		reauth.isNewTicket = func(*http.Request) bool { return true }
+
+		recorder := serve(reauth, sessionRequest("/sonar/admin/users"))
+		assert.False(t, called)
+		assert.Equal(t, http.StatusFound, recorder.Code)
+
+		serve(reauth, sessionRequest("/sonar/admin/users?carp-reauth=true&ticket=ST-1"))
+		assert.True(t, called)
+
+		reauth.isNewTicket = func(*http.Request) bool { return false }
+		reauth.now = func() time.Time { return testNow.Add(time.Minute) }
+		serve(reauth, sessionRequest("/sonar/admin/users"))
+		assert.True(t, called)
+
+		reauth.now = func() time.Time { return testNow.Add(time.Hour) }
+		recorder = serve(reauth, sessionRequest("/sonar/admin/users"))
+		assert.False(t, called)
+		assert.Equal(t, http.StatusFound, recorder.Code)
+	})
+
+	t.Run("accept renewed login if CAS keeps releasing a stale date", func(t *testing.T) {
+		reauth := createReauthentication(t, stale)
+		reauth.isNewTicket = func(*http.Request) bool { return true }
+
+		serve(reauth, sessionRequest("/sonar/admin/users?carp-reauth=true&ticket=ST-1"))
+
+		assert.True(t, called)
+	})
+}
+
+func TestRenewedTicketMiddleware(t *testing.T) {
+	var cookies []*http.Cookie
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { cookies = r.Cookies() })
+	request := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: casSessionCookieName, Value: "session-1"})
+		req.AddCookie(&http.Cookie{Name: "JWT-SESSION", Value: "jwt"})
+		return req
+	}
+
+	t.Run("drop session of renewed ticket", func(t *testing.T) {
+		renewedTicketMiddleware(next).ServeHTTP(httptest.NewRecorder(), request("/sonar/admin?carp-reauth=true&ticket=ST-1"))
+
+		assert.Equal(t, []*http.Cookie{{Name: "JWT-SESSION", Value: "jwt"}}, cookies)
+	})
+
+	t.Run("keep session of other requests", func(t *testing.T) {
+		renewedTicketMiddleware(next).ServeHTTP(httptest.NewRecorder(), request("/sonar/admin?ticket=ST-1"))
+		assert.Len(t, cookies, 2)
+
+		renewedTicketMiddleware(next).ServeHTTP(httptest.NewRecorder(), request("/sonar/admin?carp-reauth=true"))
+		assert.Len(t, cookies, 2)
+	})
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRenewValidationTransport(t *testing.T) {
+	var validated *http.Request
+	transport := renewValidationTransport{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		validated = req
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})}
+	validate := func(service string) {
+		req := httptest.NewRequest(http.MethodGet, "https://cas.example.com/cas/p3/serviceValidate?"+url.Values{"service": {service}, "ticket": {"ST-1"}}.Encode(), nil)
+		_, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+
+	validate("https://ces.example.com/sonar/admin?carp-reauth=true")
+	assert.Equal(t, "true", validated.URL.Query().Get("renew"))
+	assert.Equal(t, "ST-1", validated.URL.Query().Get("ticket"))
+
+	validate("https://ces.example.com/sonar/admin")
+	assert.False(t, validated.URL.Query().Has("renew"))
+}
+
+func TestSessionStarts_record(t *testing.T) {
+	sessions := &sessionStarts{starts: map[string]time.Time{}}
+
+	sessions.record("old", testNow)
+	sessions.record("", testNow)
+	sessions.record("new", testNow.Add(casSessionLifetime+time.Minute))
+
+	_, ok := sessions.start("old")
+	assert.False(t, ok)
+	start, ok := sessions.start("new")
+	assert.True(t, ok)
+	assert.Equal(t, testNow.Add(casSessionLifetime+time.Minute), start)
+	assert.Len(t, sessions.starts, 1)
+}
+
+func TestParseAuthenticationDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		ok       bool
+	}{
+		{name: "RFC3339", value: "2025-01-02T10:00:00Z", expected: testNow, ok: true},
+		{name: "java zone id", value: "2025-01-02T11:00:00.000+01:00[Europe/Berlin]", expected: testNow, ok: true},
+		{name: "empty", value: ""},
+		{name: "invalid", value: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := parseAuthenticationDate(tt.value)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.True(t, tt.expected.Equal(actual))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/cloudogu/sonarcarp/internal"
+)
+
+const defaultRequestIDHeader = "X-Request-ID"
+
+// validRequestID restricts request ids taken over from clients so that they cannot inject into logs or headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware takes over the request id of the client or generates a new one. The id is stored in the request
+// context, forwarded to SonarQube and returned to the client.
+func requestIDMiddleware(headerName string, next http.Handler) http.Handler {
+	if headerName == "" {
+		headerName = defaultRequestIDHeader
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(headerName)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		req.Header.Set(headerName, requestID)
+		writer.Header().Set(headerName, requestID)
+
+		next.ServeHTTP(writer, req.WithContext(internal.WithRequestID(req.Context(), requestID)))
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+func requestID(r *http.Request) string {
+	requestID, _ := internal.GetRequestID(r.Context())
+
+	return requestID
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudogu/sonarcarp/internal"
+	"github.com/cloudogu/sonarcarp/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	t.Run("take over request id of the client", func(t *testing.T) {
+		next := &mocks.Handler{
+			MserveHTTP: func(w http.ResponseWriter, r *http.Request) {
+				requestID, ok := internal.GetRequestID(r.Context())
+				assert.True(t, ok)
+				assert.Equal(t, "client-id-1", requestID)
+				assert.Equal(t, "client-id-1", r.Header.Get("X-Request-ID"))
+			},
+		}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/sonar/", nil)
+		req.Header.Set("X-Request-ID", "client-id-1")
+
+		requestIDMiddleware("", next).ServeHTTP(recorder, req)
+
+		next.AssertExpectations(t)
+		assert.Equal(t, "client-id-1", recorder.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("generate request id with custom header", func(t *testing.T) {
+		var forwardedID string
+		next := &mocks.Handler{
+			MserveHTTP: func(w http.ResponseWriter, r *http.Request) {
+				forwardedID = r.Header.Get("X-Correlation-ID")
+				assert.Equal(t, forwardedID, requestID(r))
+			},
+		}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		recorder := httptest.NewRecorder()
+
+		requestIDMiddleware("X-Correlation-ID", next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sonar/", nil))
+
+		assert.Len(t, forwardedID, 32)
+		assert.Equal(t, forwardedID, recorder.Header().Get("X-Correlation-ID"))
+	})
+
+	t.Run("replace invalid request id", func(t *testing.T) {
+		next := &mocks.Handler{
+			MserveHTTP: func(w http.ResponseWriter, r *http.Request) {
+				assert.Len(t, requestID(r), 32)
+			},
+		}
+		next.On("ServeHTTP", mock.Anything, mock.Anything)
+		req := httptest.NewRequest(http.MethodGet, "/sonar/", nil)
+		req.Header.Set("X-Request-ID", "evil\nid")
+
+		requestIDMiddleware("", next).ServeHTTP(httptest.NewRecorder(), req)
+
+		next.AssertExpectations(t)
+	})
+}
+
+func TestRequestLogFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sonar/projects", nil)
+	req = req.WithContext(internal.WithRequestID(req.Context(), "abc"))
+
+	fields := requestLogFields(req)
+
+	assert.Equal(t, internal.LogFields{"method": "GET", "path": "/sonar/projects", "requestId": "abc"}, fields)
+}
@@ -1,11 +1,11 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/url"
-	"path"
 	"strconv"
 
 	"github.com/cloudogu/go-cas"
@@ -13,19 +13,45 @@ import (
 	"github.com/op/go-logging"
 )
 
-var log = logging.MustGetLogger("sonarcarp")
+var (
+	log       = logging.MustGetLogger(config.LogModuleProxy)
+	casLog    = logging.MustGetLogger(config.LogModuleCas)
+	accessLog = logging.MustGetLogger(config.LogModuleAccess)
+)
+
+// NewServer creates the carp server which sends all requests to SonarQube with upstreamTransport.
+func NewServer(configuration config.Configuration, upstreamTransport http.RoundTripper) (*http.Server, error) {
+	apiRequests = newAPIRequestMatcher(configuration.APIRequestPaths)
 
-func NewServer(configuration config.Configuration) (*http.Server, error) {
-	staticResourceHandler, err := createStaticFileHandler()
+	var err error
+	trustedProxies, err = newProxyNetworks(configuration.TrustedProxies)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create static handler: %w", err)
+		return nil, fmt.Errorf("failed to read trusted proxies: %w", err)
+	}
+
+	err = initTracing(configuration.TracingExporter, configuration.TracingOtlpEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+
+	casEndpoints, err := newCasEndpoints(configuration.CasUrl, configuration.CasFailoverCooldown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CAS client: %w", err)
 	}
 
-	casClient, err := NewCasClientFactory(configuration)
+	casClient, err := createCasClient(configuration, casEndpoints)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CAS client: %w", err)
 	}
 
+	pages, err := newPageRenderer(configuration.CarpResourceDir, configuration.BaseUrl, casLogoutURL(casEndpoints))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create static handler: %w", err)
+	}
+
+	staticResourceHandler := createStaticFileHandler(pages)
+	errorPages := newErrorPages(pages)
+
 	headers := authorizationHeaders{
 		Principal: configuration.PrincipalHeader,
 		Role:      configuration.RoleHeader,
@@ -35,15 +61,57 @@ func NewServer(configuration config.Configuration) (*http.Server, error) {
 
 	router := http.NewServeMux()
 
+	poller, err := newStatusPoller(configuration.ServiceUrl, configuration.BaseUrl, configuration.StatusPollInterval, configuration.StatusFailureLimit, upstreamTransport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create status poller: %w", err)
+	}
+
+	go poller.Run(context.Background())
+
+	migration, err := newMigrationHandler(configuration.ServiceUrl, configuration.BaseUrl, configuration.CesAdminGroup, poller, staticResourceHandler, pages, upstreamTransport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration handler: %w", err)
+	}
+
+	logLevels, err := newLogLevelHandler(configuration.BaseUrl, configuration.CesAdminGroup, configuration.LogLevelResetTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log level handler: %w", err)
+	}
+
+	var middlewares []middleware
+	if configuration.GatewayMode {
+		gateway := newGatewayMode(configuration.GatewayLoginPath, configuration.BaseUrl, configuration.GatewayRecheckInterval, casClient.LoginUrlForRequest, casEndpoints, cas.IsAuthenticated)
+		middlewares = append(middlewares, gateway.Middleware)
+	}
+	middlewares = append(middlewares, casOutageMiddleware(casEndpoints, errorPages, cas.IsAuthenticated))
+	if !configuration.RedirectUnauthenticatedAPIRequests {
+		middlewares = append(middlewares, unauthenticatedAPIMiddleware(casLoginURL(casEndpoints, configuration.BaseUrl), cas.IsAuthenticated))
+	}
+	if len(configuration.ReauthPaths) > 0 {
+		reauth, err := newReauthentication(configuration.ReauthPaths, configuration.ReauthMaxAge, configuration.BaseUrl, casClient.LoginUrlForRequest, casServiceLoginURL(casEndpoints))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create re-authentication: %w", err)
+		}
+		middlewares = append(middlewares, reauth.Middleware)
+	}
+	middlewares = append(middlewares, migration.Middleware, logLevels.Middleware)
+
 	pHandler, err := createProxyHandler(
 		configuration.ServiceUrl,
 		headers,
+		configuration.AnonymousPaths,
 		casClient,
+		upstreamTransport,
+		errorPages.ServeUpstreamError,
 		configuration.LogoutPath,
 		configuration.LogoutRedirectPath,
+		middlewares...,
 	)
 
-	router.Handle("/", pHandler)
+	router.Handle("/", readinessMiddleware(pHandler, poller, staticResourceHandler, poller.interval))
+	// the migration endpoints must stay reachable while SonarQube migrates and is not ready
+	router.Handle(migration.migrationPath, pHandler)
+	router.Handle(logLevels.path, pHandler)
 
 	if len(configuration.CarpResourcePath) != 0 {
 		router.Handle(configuration.CarpResourcePath, http.StripPrefix(configuration.CarpResourcePath, loggingMiddleware(staticResourceHandler)))
@@ -51,40 +119,103 @@ func NewServer(configuration config.Configuration) (*http.Server, error) {
 
 	log.Debugf("starting server on port %d", configuration.Port)
 
-	return &http.Server{
+	bodyLimiter := newRequestBodyLimiter(configuration.MaxRequestBodyBytes, configuration.RequestBodyLimits)
+
+	server := &http.Server{
 		Addr:    ":" + strconv.Itoa(configuration.Port),
-		Handler: router,
-	}, nil
+		Handler: requestIDMiddleware(configuration.RequestIDHeader, tracingMiddleware(bodyLimiter.Middleware(router))),
+	}
+	applyServerLimits(server, configuration)
+
+	if configuration.TLSCertFile != "" || configuration.TLSKeyFile != "" {
+		server.TLSConfig, err = createTLSConfig(configuration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+
+	return server, nil
+}
+
+func createTLSConfig(configuration config.Configuration) (*tls.Config, error) {
+	if configuration.TLSCertFile == "" || configuration.TLSKeyFile == "" {
+		return nil, fmt.Errorf("tls-cert-file and tls-key-file must be set together")
+	}
+
+	reloader, err := newCertificateReloader(configuration.TLSCertFile, configuration.TLSKeyFile, configuration.TLSReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(configuration.TLSMinVersion, configuration.TLSCipherSuites, reloader)
+	if err != nil {
+		return nil, err
+	}
+
+	go reloader.Run(context.Background())
+
+	return tlsConfig, nil
+}
+
+// NewRedirectServer creates a plain HTTP server which redirects to the HTTPS port. It returns nil if carp does not
+// serve HTTPS or no http-redirect-port is configured.
+func NewRedirectServer(configuration config.Configuration) *http.Server {
+	if configuration.HTTPRedirectPort == 0 || configuration.TLSCertFile == "" {
+		return nil
+	}
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(configuration.HTTPRedirectPort),
+		Handler: httpsRedirectHandler(configuration.Port),
+	}
+	applyServerLimits(server, configuration)
+
+	return server
 }
 
 func NewCasClientFactory(configuration config.Configuration) (*cas.Client, error) {
-	casUrl, err := url.Parse(configuration.CasUrl)
+	endpoints, err := newCasEndpoints(configuration.CasUrl, configuration.CasFailoverCooldown)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse cas url: %s: %w", configuration.CasUrl, err)
+		return nil, err
 	}
 
+	return createCasClient(configuration, endpoints)
+}
+
+// casLogoutURL returns the logout url of the current CAS for the page templates.
+func casLogoutURL(endpoints *casEndpoints) func() string {
+	return func() string {
+		logoutURL, err := endpoints.Logout()
+		if err != nil {
+			return ""
+		}
+
+		return logoutURL.String()
+	}
+}
+
+func createCasClient(configuration config.Configuration, endpoints *casEndpoints) (*cas.Client, error) {
 	serviceUrl, err := url.Parse(configuration.ServiceUrl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse service url: %s: %w", configuration.ServiceUrl, err)
 	}
 
-	urlScheme := cas.NewDefaultURLScheme(casUrl)
-	urlScheme.ServiceValidatePath = path.Join("p3", "serviceValidate")
-
-	httpClient := &http.Client{}
-	if configuration.SkipSSLVerification {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		httpClient.Transport = transport
+	httpClient, err := createCasHttpClient(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CAS http client: %w", err)
 	}
+	httpClient.Transport = renewValidationTransport{next: newCasRetryTransport(httpClient.Transport, endpoints, configuration)}
 
 	return cas.NewClient(&cas.Options{
 		URL:       serviceUrl,
 		Client:    httpClient,
-		URLScheme: urlScheme,
+		URLScheme: endpoints,
 		IsLogoutRequest: func(r *http.Request) bool {
-			return r.Method == "POST" && (r.URL.Path == "/sonar/" || r.URL.Path == "/sonar")
+			isLogoutRequest := r.Method == "POST" && (r.URL.Path == "/sonar/" || r.URL.Path == "/sonar")
+			if isLogoutRequest {
+				audit(r, auditEventSingleLogout, auditOutcomeSuccess, "")
+			}
+			return isLogoutRequest
 		},
 	}), nil
 }
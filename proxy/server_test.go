@@ -3,6 +3,7 @@ package proxy
 import (
 	"github.com/cloudogu/sonarcarp/config"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
@@ -10,7 +11,7 @@ func TestNewServer(t *testing.T) {
 	server, err := NewServer(config.Configuration{
 		Port:             8080,
 		CarpResourcePath: "/carp-resources",
-	})
+	}, http.DefaultTransport)
 	assert.NoError(t, err)
 	assert.NotNil(t, server)
 	assert.NotNil(t, server.Handler)
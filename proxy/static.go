@@ -2,7 +2,6 @@ package proxy
 
 import (
 	"embed"
-	"fmt"
 	"io/fs"
 	"net/http"
 )
@@ -10,17 +9,12 @@ import (
 //go:embed public
 var content embed.FS
 
-func createStaticFileHandler() (staticHandler, error) {
-	publicFileDir, err := fs.Sub(content, "public")
-	if err != nil {
-		return staticHandler{}, fmt.Errorf("could not read subdir public: %w", err)
-	}
-
+func createStaticFileHandler(pages pageRenderer) staticHandler {
 	return staticHandler{
-		publicFileDir: publicFileDir,
-		fileServer:    http.FileServerFS(content),
-		serveFileFunc: http.ServeFileFS,
-	}, nil
+		publicFileDir: pages.files,
+		fileServer:    http.StripPrefix("/public", http.FileServerFS(pages.files)),
+		serveFileFunc: pages.ServePage,
+	}
 }
 
 type staticHandler struct {
@@ -34,6 +28,19 @@ func (s staticHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request)
 }
 
 func (s staticHandler) ServeUnauthorized(writer http.ResponseWriter, req *http.Request) {
-	writer.WriteHeader(http.StatusUnauthorized)
-	s.serveFileFunc(writer, req, s.publicFileDir, "401.html")
+	s.servePage(writer, req, http.StatusUnauthorized, "401.html")
+}
+
+func (s staticHandler) ServeStarting(writer http.ResponseWriter, req *http.Request) {
+	s.servePage(writer, req, http.StatusServiceUnavailable, "starting.html")
+}
+
+func (s staticHandler) ServeMaintenance(writer http.ResponseWriter, req *http.Request) {
+	s.servePage(writer, req, http.StatusServiceUnavailable, "maintenance.html")
+}
+
+func (s staticHandler) servePage(writer http.ResponseWriter, req *http.Request, statusCode int, name string) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(statusCode)
+	s.serveFileFunc(writer, req, s.publicFileDir, name)
 }
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCertificateReloadInterval = 30 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificateReloader serves the certificate of the configured files and reloads it when the files change. New
+// handshakes use the reloaded certificate while established connections are kept.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string, interval time.Duration) (*certificateReloader, error) {
+	if interval <= 0 {
+		interval = defaultCertificateReloadInterval
+	}
+
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	_, err := reloader.reloadIfChanged()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate and is used as tls.Config.GetCertificate.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.certificate, nil
+}
+
+// Run checks the certificate files for changes until the context is cancelled.
+func (r *certificateReloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reloadIfChanged()
+		if err != nil {
+			// keep serving the last valid certificate, the files may be in the middle of an update
+			log.Errorf("failed to reload TLS certificate: %s", err.Error())
+			continue
+		}
+
+		if reloaded {
+			log.Infof("Reloaded TLS certificate from %s", r.certFile)
+		}
+	}
+}
+
+func (r *certificateReloader) reloadIfChanged() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.certificate != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate '%s' with key '%s': %w", r.certFile, r.keyFile, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.certificate = &certificate
+	r.modTime = modTime
+
+	return true, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat '%s': %w", file, err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func newTLSConfig(minVersion string, cipherSuites []string, reloader *certificateReloader) (*tls.Config, error) {
+	version := uint16(tls.VersionTLS12)
+	if minVersion != "" {
+		var ok bool
+		version, ok = tlsVersions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version '%s', only 1.2 and 1.3 are allowed", minVersion)
+		}
+	}
+
+	suites, err := parseCipherSuites(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   suites,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// parseCipherSuites maps the IANA names of cipher suites to their ids. Insecure cipher suites are rejected. The
+// cipher suites only apply to TLS 1.2 because TLS 1.3 suites are not configurable.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	available := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		id, ok := available[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// httpsRedirectHandler redirects plain HTTP requests to the HTTPS port while keeping path and query.
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if hostname, _, err := net.SplitHostPort(req.Host); err == nil {
+			host = hostname
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		http.Redirect(writer, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
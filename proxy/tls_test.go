@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCertificate(t *testing.T, dir, commonName string, modTime time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	return certFile, keyFile
+}
+
+func servedCommonName(t *testing.T, reloader *certificateReloader) string {
+	t.Helper()
+
+	certificate, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	t.Run("reload changed certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCertificate(t, dir, "old.example.com", time.Now().Add(-time.Minute))
+		reloader, err := newCertificateReloader(certFile, keyFile, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, "old.example.com", servedCommonName(t, reloader))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go reloader.Run(ctx)
+
+		writeCertificate(t, dir, "new.example.com", time.Now())
+
+		assert.Eventually(t, func() bool {
+			return servedCommonName(t, reloader) == "new.example.com"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("keep certificate if reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCertificate(t, dir, "valid.example.com", time.Now().Add(-time.Minute))
+		reloader, err := newCertificateReloader(certFile, keyFile, time.Minute)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+		reloaded, err := reloader.reloadIfChanged()
+
+		require.Error(t, err)
+		assert.False(t, reloaded)
+		assert.Equal(t, "valid.example.com", servedCommonName(t, reloader))
+	})
+
+	t.Run("fail on missing files", func(t *testing.T) {
+		_, err := newCertificateReloader("/does/not/exist.crt", "/does/not/exist.key", 0)
+
+		assert.ErrorContains(t, err, "failed to stat '/does/not/exist.crt'")
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "localhost", time.Now())
+	reloader, err := newCertificateReloader(certFile, keyFile, 0)
+	require.NoError(t, err)
+
+	t.Run("default to TLS 1.2 with go cipher suites", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig("", nil, reloader)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+		assert.Nil(t, tlsConfig.CipherSuites)
+	})
+
+	t.Run("configure version and cipher suites", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig("1.3", []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}, reloader)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, tlsConfig.CipherSuites)
+	})
+
+	t.Run("reject old version", func(t *testing.T) {
+		_, err := newTLSConfig("1.0", nil, reloader)
+
+		assert.ErrorContains(t, err, "unsupported minimum TLS version '1.0'")
+	})
+
+	t.Run("reject insecure cipher suite", func(t *testing.T) {
+		_, err := newTLSConfig("", []string{"TLS_RSA_WITH_RC4_128_SHA"}, reloader)
+
+		assert.ErrorContains(t, err, "unknown or insecure cipher suite 'TLS_RSA_WITH_RC4_128_SHA'")
+	})
+
+	t.Run("serve handshake with reloaded certificate", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig("", nil, reloader)
+		require.NoError(t, err)
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, acceptErr := listener.Accept()
+			if acceptErr == nil {
+				_ = conn.(*tls.Conn).Handshake()
+				_ = conn.Close()
+			}
+		}()
+
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, "localhost", conn.ConnectionState().PeerCertificates[0].Subject.CommonName)
+	})
+}
+
+func TestHttpsRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		port      int
+		host      string
+		target    string
+		wantedURL string
+	}{
+		{"custom port", 8443, "sonar.example.com:8080", "/sonar/projects?id=1", "https://sonar.example.com:8443/sonar/projects?id=1"},
+		{"default port", 443, "sonar.example.com", "/sonar/", "https://sonar.example.com/sonar/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = tt.host
+
+			httpsRedirectHandler(tt.port).ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+			assert.Equal(t, tt.wantedURL, recorder.Header().Get("Location"))
+		})
+	}
+}
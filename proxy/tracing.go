@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/cloudogu/go-cas"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracingExporterOtlp   = "otlp"
+	tracingExporterStdout = "stdout"
+	tracerName            = "github.com/cloudogu/sonarcarp/proxy"
+	serviceName           = "sonarcarp"
+)
+
+var (
+	tracer     = otel.Tracer(tracerName)
+	propagator = propagation.TraceContext{}
+)
+
+type casSpanContextKey int
+
+const casSpanKey casSpanContextKey = iota
+
+// newTracerProvider creates a tracer provider for the exporter type. Spans of the stdout exporter are written
+// synchronously to output so that they can be verified without a collector.
+func newTracerProvider(exporterType string, otlpEndpoint string, output io.Writer) (*sdktrace.TracerProvider, error) {
+	var options []sdktrace.TracerProviderOption
+
+	switch exporterType {
+	case tracingExporterOtlp:
+		var exporterOptions []otlptracehttp.Option
+		if otlpEndpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(otlpEndpoint))
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case tracingExporterStdout:
+		if output == nil {
+			output = os.Stdout
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(output))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithSyncer(exporter))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter '%s', only %s and %s are allowed", exporterType, tracingExporterOtlp, tracingExporterStdout)
+	}
+
+	options = append(options, sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))))
+
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// initTracing installs the global tracer provider if an exporter is configured.
+func initTracing(exporterType string, otlpEndpoint string) error {
+	if exporterType == "" {
+		return nil
+	}
+
+	provider, err := newTracerProvider(exporterType, otlpEndpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer(tracerName)
+	log.Infof("Export traces with %s exporter", exporterType)
+
+	return nil
+}
+
+// tracingMiddleware starts the server span of a request. The trace context of the client is continued if present.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		// the path is only an attribute, span names must not contain ids of the url
+		ctx, span := tracer.Start(ctx, req.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLPath(req.URL.Path),
+			attribute.String("carp.request_id", requestID(req)),
+		))
+		defer span.End()
+
+		srw := &statusResponseWriter{ResponseWriter: writer, httpStatusCode: http.StatusOK}
+		next.ServeHTTP(srw, req.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(srw.httpStatusCode))
+		if srw.httpStatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(srw.httpStatusCode))
+		}
+	})
+}
+
+type casSpan struct {
+	span   trace.Span
+	parent trace.Span
+}
+
+// casSpanMiddleware wraps the CAS handler. It starts a span which covers the CAS session lookup and the ticket
+// validation against CAS and which is ended by endCasSpanMiddleware as soon as the CAS handler passes the request on.
+func casSpanMiddleware(casHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		spanName := "cas.session"
+		if req.URL.Query().Get("ticket") != "" {
+			spanName = "cas.validate-ticket"
+		}
+
+		parent := trace.SpanFromContext(req.Context())
+		ctx, span := tracer.Start(req.Context(), spanName)
+		// End is a no-op if endCasSpanMiddleware already ended the span
+		defer span.End()
+
+		ctx = context.WithValue(ctx, casSpanKey, casSpan{span: span, parent: parent})
+		casHandler.ServeHTTP(writer, req.WithContext(ctx))
+	})
+}
+
+// endCasSpanMiddleware ends the CAS span and continues with the server span so that the following spans are not
+// children of the CAS span.
+func endCasSpanMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		cs, ok := req.Context().Value(casSpanKey).(casSpan)
+		if !ok {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		cs.span.SetAttributes(attribute.Bool("cas.authenticated", cas.IsAuthenticated(req)))
+		cs.span.End()
+
+		next.ServeHTTP(writer, req.WithContext(trace.ContextWithSpan(req.Context(), cs.parent)))
+	})
+}
+
+// injectTraceContext writes the W3C traceparent of the current span into the request headers for SonarQube.
+func injectTraceContext(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const clientTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		SpanID string
+	}
+}
+
+func useStdoutTracer(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	output := &bytes.Buffer{}
+	provider, err := newTracerProvider(tracingExporterStdout, "", output)
+	require.NoError(t, err)
+
+	originalTracer := tracer
+	tracer = provider.Tracer(tracerName)
+	t.Cleanup(func() { tracer = originalTracer })
+
+	return output
+}
+
+func readSpans(t *testing.T, output *bytes.Buffer) map[string]exportedSpan {
+	t.Helper()
+
+	spans := map[string]exportedSpan{}
+	decoder := json.NewDecoder(output)
+	for decoder.More() {
+		var span exportedSpan
+		require.NoError(t, decoder.Decode(&span))
+		spans[span.Name] = span
+	}
+
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("continue client trace and propagate traceparent upstream", func(t *testing.T) {
+		output := useStdoutTracer(t)
+
+		var upstreamHeader http.Header
+		inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(r.Context(), "upstream.forward")
+			defer span.End()
+
+			injectTraceContext(ctx, r.Header)
+			upstreamHeader = r.Header.Clone()
+			w.WriteHeader(http.StatusNoContent)
+		})
+		fakeCasHandler := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r)
+			})
+		}
+		handler := tracingMiddleware(casSpanMiddleware(fakeCasHandler(endCasSpanMiddleware(inner))))
+
+		req := httptest.NewRequest(http.MethodGet, "/sonar/?ticket=ST-1", nil)
+		req.Header.Set("traceparent", clientTraceparent)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := readSpans(t, output)
+		require.Contains(t, spans, "GET")
+		require.Contains(t, spans, "cas.validate-ticket")
+		require.Contains(t, spans, "upstream.forward")
+
+		server := spans["GET"]
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID)
+		assert.Equal(t, server.SpanContext.SpanID, spans["cas.validate-ticket"].Parent.SpanID)
+		// the forward span is a sibling of the CAS span and not its child
+		assert.Equal(t, server.SpanContext.SpanID, spans["upstream.forward"].Parent.SpanID)
+
+		traceparent := upstreamHeader.Get("traceparent")
+		assert.True(t, strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans["upstream.forward"].SpanContext.SpanID))
+	})
+
+	t.Run("start new trace without traceparent", func(t *testing.T) {
+		output := useStdoutTracer(t)
+		inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+		})
+
+		tracingMiddleware(inner).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sonar/api/projects", nil))
+
+		spans := readSpans(t, output)
+		require.Contains(t, spans, "GET")
+		assert.Equal(t, "0000000000000000", spans["GET"].Parent.SpanID)
+	})
+
+	t.Run("fail on unknown exporter", func(t *testing.T) {
+		_, err := newTracerProvider("zipkin", "", nil)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "unknown tracing exporter 'zipkin'")
+	})
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+)
+
+const (
+	defaultUpstreamDialTimeout         = 10 * time.Second
+	defaultUpstreamTLSHandshakeTimeout = 10 * time.Second
+	defaultUpstreamIdleConnTimeout     = 90 * time.Second
+	defaultUpstreamMaxIdleConnsPerHost = 32
+)
+
+// NewUpstreamTransport creates the transport which sends requests to SonarQube. It is shared by the proxy and all
+// clients which talk to SonarQube, so that the upstream TLS settings apply to each of them.
+func NewUpstreamTransport(configuration config.Configuration) (http.RoundTripper, error) {
+	serviceURL, err := url.Parse(configuration.ServiceUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service url: %s: %w", configuration.ServiceUrl, err)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(configuration.UpstreamDialTimeout, defaultUpstreamDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   durationOrDefault(configuration.UpstreamTLSHandshakeTimeout, defaultUpstreamTLSHandshakeTimeout),
+		IdleConnTimeout:       durationOrDefault(configuration.UpstreamIdleConnTimeout, defaultUpstreamIdleConnTimeout),
+		MaxIdleConnsPerHost:   defaultUpstreamMaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+	if configuration.UpstreamMaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = configuration.UpstreamMaxIdleConnsPerHost
+	}
+
+	if serviceURL.Scheme == "https" {
+		transport.TLSClientConfig, err = createUpstreamTLSConfig(configuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if configuration.UpstreamHTTP2 {
+		protocols := new(http.Protocols)
+		if serviceURL.Scheme == "https" {
+			protocols.SetHTTP1(true)
+			protocols.SetHTTP2(true)
+		} else {
+			// plain HTTP/2 needs prior knowledge because there is no ALPN negotiation
+			protocols.SetUnencryptedHTTP2(true)
+		}
+		transport.Protocols = protocols
+	}
+
+	return &upstreamTimeoutTransport{
+		next:                  transport,
+		responseHeaderTimeout: configuration.UpstreamResponseHeaderTimeout,
+		pathTimeouts:          configuration.UpstreamPathTimeouts,
+	}, nil
+}
+
+func createUpstreamTLSConfig(configuration config.Configuration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if configuration.UpstreamCAFile != "" {
+		pool, err := loadCertPool(configuration.UpstreamCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if configuration.UpstreamClientCertFile != "" || configuration.UpstreamClientKeyFile != "" {
+		if configuration.UpstreamClientCertFile == "" || configuration.UpstreamClientKeyFile == "" {
+			return nil, fmt.Errorf("upstream-client-cert-file and upstream-client-key-file must be set together")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(configuration.UpstreamClientCertFile, configuration.UpstreamClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client certificate '%s': %w", configuration.UpstreamClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func durationOrDefault(duration, defaultDuration time.Duration) time.Duration {
+	if duration <= 0 {
+		return defaultDuration
+	}
+
+	return duration
+}
+
+// upstreamTimeoutTransport limits the time until SonarQube sends the response headers. Long-running endpoints get
+// their own limit from the path timeouts, the longest matching path prefix wins. A timeout of 0 waits forever.
+type upstreamTimeoutTransport struct {
+	next                  http.RoundTripper
+	responseHeaderTimeout time.Duration
+	pathTimeouts          []config.UpstreamPathTimeout
+}
+
+func (t *upstreamTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.timeoutFor(req.URL.Path)
+	if timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// the timer cancelled the request before the headers arrived
+		cancel()
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return nil, fmt.Errorf("timeout of %s exceeded while waiting for response headers of %s: %w", timeout, req.URL.Path, context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the request context must live until the body is read
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+func (t *upstreamTimeoutTransport) timeoutFor(path string) time.Duration {
+	timeout := t.responseHeaderTimeout
+	longestPrefix := -1
+	for _, pathTimeout := range t.pathTimeouts {
+		if strings.HasPrefix(path, pathTimeout.PathPrefix) && len(pathTimeout.PathPrefix) > longestPrefix {
+			timeout = pathTimeout.Timeout
+			longestPrefix = len(pathTimeout.PathPrefix)
+		}
+	}
+
+	return timeout
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudogu/sonarcarp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamTimeoutTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sonar/api/server/version" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("10.6"))
+	}))
+	defer upstream.Close()
+
+	transport, err := NewUpstreamTransport(config.Configuration{
+		ServiceUrl:                    upstream.URL + "/sonar/",
+		UpstreamResponseHeaderTimeout: 50 * time.Millisecond,
+		UpstreamPathTimeouts: []config.UpstreamPathTimeout{
+			{PathPrefix: "/sonar/api/ce/", Timeout: 10 * time.Millisecond},
+			{PathPrefix: "/sonar/api/ce/submit", Timeout: time.Second},
+		},
+	})
+	require.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	t.Run("read body of fast response", func(t *testing.T) {
+		resp, err := client.Get(upstream.URL + "/sonar/api/server/version")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		require.NoError(t, err)
+		assert.Equal(t, "10.6", string(body))
+	})
+
+	t.Run("fail on slow response", func(t *testing.T) {
+		_, err := client.Get(upstream.URL + "/sonar/api/projects/search")
+
+		assert.ErrorContains(t, err, "timeout of 50ms exceeded while waiting for response headers of /sonar/api/projects/search")
+	})
+
+	t.Run("use timeout of longest path prefix", func(t *testing.T) {
+		resp, err := client.Post(upstream.URL+"/sonar/api/ce/submit", "text/plain", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestNewUpstreamTransport(t *testing.T) {
+	t.Run("verify HTTPS upstream with upstream-ca-file and HTTP/2", func(t *testing.T) {
+		upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		upstream.EnableHTTP2 = true
+		upstream.StartTLS()
+		defer upstream.Close()
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0600))
+
+		transport, err := NewUpstreamTransport(config.Configuration{ServiceUrl: upstream.URL, UpstreamCAFile: caFile, UpstreamHTTP2: true})
+		require.NoError(t, err)
+
+		resp, err := (&http.Client{Transport: transport}).Get(upstream.URL)
+
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, 2, resp.ProtoMajor)
+	})
+
+	t.Run("fail on client certificate without key", func(t *testing.T) {
+		_, err := NewUpstreamTransport(config.Configuration{ServiceUrl: "https://sonar:9000/sonar/", UpstreamClientCertFile: "client.crt"})
+
+		assert.ErrorContains(t, err, "upstream-client-cert-file and upstream-client-key-file must be set together")
+	})
+}